@@ -0,0 +1,118 @@
+package main
+
+// ====================================================================================
+// MULTI-APP HOSTING
+// ====================================================================================
+// One server can host several Ton.Place mini apps. Each app has its own ID,
+// secrets and API client. The "app_id" launch parameter selects the app:
+// its secrets verify the signature, and its credentials are used for all
+// Ton.Place API calls made for that user (the app ID is kept in the session).
+//
+// Launches and sessions for an app_id that is not registered are rejected.
+//
+// To host another app, add it to appRegistry below:
+//
+//	&AppConfig{ID: "456", Secrets: []AppSecret{{ID: "current", Secret: "SECOND_APP_SECRET"}}},
+// ====================================================================================
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// AppConfig holds everything the server needs to serve one Ton.Place app.
+type AppConfig struct {
+	// ID - Application ID from Ton.Place (matches the app_id launch parameter)
+	ID string
+
+	// Secrets - Secrets accepted for launch signatures, current secret first
+	// The current secret is also used to authenticate API calls
+	Secrets []AppSecret
+
+	// Client - Ton.Place API client for this app
+	// Created by NewAppRegistry when nil
+	Client *tonplace.Client
+
+	// Verifier - Checks launch parameters of this app
+	// Created by NewAppRegistry with the default policy and Secrets when nil
+	Verifier *Verifier
+}
+
+// AppRegistry maps app IDs to their configuration. It is read-only after creation
+// and therefore safe for concurrent use.
+type AppRegistry struct {
+	apps map[string]*AppConfig
+}
+
+// appRegistry - All apps served by this server
+var appRegistry = mustAppRegistry(
+	&AppConfig{ID: APP_ID, Secrets: APP_SECRETS},
+)
+
+// NewAppRegistry validates the app configurations and creates API clients
+// and verifiers for apps that don't have one.
+func NewAppRegistry(apps ...*AppConfig) (*AppRegistry, error) {
+	reg := &AppRegistry{apps: make(map[string]*AppConfig, len(apps))}
+	for _, app := range apps {
+		if app.ID == "" {
+			return nil, errors.New("app config without ID")
+		}
+		if _, dup := reg.apps[app.ID]; dup {
+			return nil, fmt.Errorf("app %s is registered twice", app.ID)
+		}
+		if len(app.Secrets) == 0 || app.Secrets[0].Secret == "" {
+			return nil, fmt.Errorf("app %s has no secret", app.ID)
+		}
+		if app.Client == nil {
+			app.Client = newAPIClient(app.ID, app.Secrets[0].Secret)
+		}
+		if app.Verifier == nil {
+			app.Verifier = NewVerifier(app.Secrets)
+		}
+		reg.apps[app.ID] = app
+	}
+	return reg, nil
+}
+
+// mustAppRegistry is like NewAppRegistry but panics on invalid configuration.
+func mustAppRegistry(apps ...*AppConfig) *AppRegistry {
+	reg, err := NewAppRegistry(apps...)
+	if err != nil {
+		panic("invalid app configuration: " + err.Error())
+	}
+	return reg
+}
+
+// Lookup returns the configuration of an app, or false if the app is not registered.
+func (r *AppRegistry) Lookup(appID string) (*AppConfig, bool) {
+	app, ok := r.apps[appID]
+	return app, ok
+}
+
+// IDs returns the IDs of all registered apps.
+func (r *AppRegistry) IDs() []string {
+	ids := make([]string, 0, len(r.apps))
+	for id := range r.apps {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// newAPIClient creates the Ton.Place API client of one app.
+// It reuses one HTTP connection pool instead of creating a client per request.
+// Each app gets its own rate limiter so a burst of users can't exceed Ton.Place
+// limits, and a circuit breaker so pages load fast while Ton.Place is down.
+func newAPIClient(appID, secret string) *tonplace.Client {
+	return tonplace.NewClient(appID, secret,
+		tonplace.WithBaseURL(TON_PLACE_API),
+		tonplace.WithRateLimiter(tonplace.NewRateLimiter(API_RATE_LIMIT, API_RATE_BURST)),
+		tonplace.WithCircuitBreaker(tonplace.NewCircuitBreaker(tonplace.BreakerSettings{
+			OnStateChange: func(from, to tonplace.BreakerState) {
+				log.Printf("Ton.Place API circuit breaker (app %s): %s -> %s", appID, from, to)
+			},
+		})),
+	)
+}
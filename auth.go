@@ -0,0 +1,239 @@
+package main
+
+// ====================================================================================
+// AUTHENTICATION MIDDLEWARE
+// ====================================================================================
+// RequireTonPlaceUser wraps a handler so it only runs for a verified Ton.Place user.
+// The user is authenticated from either:
+//   1. Launch parameters (app_id, user_id, ts, hash, ...) - verified and turned
+//      into a new session cookie
+//   2. The session cookie from an earlier launch - used on page reloads (when the
+//      launch signature has expired)
+//
+// API calls from the page don't use the cookie; they send an access token and are
+// wrapped in RequireAccessToken instead (see tokens.go).
+//
+// The handler reads the verified user from the request context:
+//
+//	http.Handle("/profile", RequireTonPlaceUser(RespondHTML, http.HandlerFunc(handleProfile)))
+//
+//	func handleProfile(w http.ResponseWriter, r *http.Request) {
+//	    user, _ := UserFromContext(r.Context())
+//	    fmt.Fprintf(w, "Hello, %s!", user.FirstName)
+//	}
+// ====================================================================================
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// AuthFailureMode selects how RequireTonPlaceUser answers unauthenticated requests.
+type AuthFailureMode int
+
+const (
+	// RespondHTML - Render the demo page with the error (for pages)
+	RespondHTML AuthFailureMode = iota
+
+	// RespondJSON - Answer 401 with {"error": "..."} (for API endpoints)
+	RespondJSON
+)
+
+// Auth is the result of a successful authentication.
+type Auth struct {
+	// User - Verified user parameters (Timestamp and Hash are empty for sessions)
+	User UserParams
+
+	// UserID - Verified user ID as number
+	UserID int64
+
+	// App - Configuration of the app the user opened
+	App *AppConfig
+
+	// Session - Session of the user (new after a launch, restored otherwise)
+	Session Session
+
+	// FromSession - True if authenticated by session cookie instead of launch parameters
+	FromSession bool
+}
+
+// authContextKey is the context key for *Auth.
+type authContextKey struct{}
+
+// UserFromContext returns the verified user stored by RequireTonPlaceUser
+// or RequireAccessToken.
+// Returns false if the request did not pass through the middleware.
+func UserFromContext(ctx context.Context) (UserParams, bool) {
+	auth, ok := AuthFromContext(ctx)
+	if !ok {
+		return UserParams{}, false
+	}
+	return auth.User, true
+}
+
+// AuthFromContext returns the full authentication result stored by RequireTonPlaceUser
+// or RequireAccessToken.
+func AuthFromContext(ctx context.Context) (*Auth, bool) {
+	auth, ok := ctx.Value(authContextKey{}).(*Auth)
+	return auth, ok
+}
+
+// withAuth returns a copy of ctx carrying the authentication result.
+func withAuth(ctx context.Context, auth *Auth) context.Context {
+	return context.WithValue(ctx, authContextKey{}, auth)
+}
+
+// RequireTonPlaceUser authenticates the request and calls next with the verified
+// user in the request context. Unauthenticated requests never reach next; they are
+// answered according to mode.
+func RequireTonPlaceUser(mode AuthFailureMode, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, params, errMsg := authenticate(w, r)
+		if auth == nil {
+			if mode == RespondJSON {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": errMsg})
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			renderPage(w, PageData{User: params, Error: errMsg})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAuth(r.Context(), auth)))
+	})
+}
+
+// authenticate verifies the launch parameters or the session of a request.
+// On success it returns the authentication result (a new session cookie is set
+// after a fresh launch). On failure it returns nil, the unverified launch
+// parameters and a message that is safe to show to the user.
+func authenticate(w http.ResponseWriter, r *http.Request) (*Auth, UserParams, string) {
+	// Get all query parameters from the request
+	// Ton.Place appends these to your app URL when user opens the app
+	queryParams := r.URL.Query()
+
+	// In strict mode, reject ambiguous or malformed query strings before
+	// anything else looks at them
+	var strictErr error
+	if STRICT_LAUNCH_PARAMS && r.URL.RawQuery != "" {
+		queryParams, strictErr = ParseStrictLaunchQuery(r.URL.RawQuery)
+	}
+
+	// Extract known parameters for display (these are the common ones)
+	// But signature verification uses ALL parameters dynamically
+	params := UserParams{
+		AppID:     queryParams.Get("app_id"),
+		UserID:    queryParams.Get("user_id"),
+		Timestamp: queryParams.Get("ts"),
+		FirstName: queryParams.Get("first_name"), // May be empty if not sent
+		LastName:  queryParams.Get("last_name"),  // May be empty if not sent
+		Hash:      queryParams.Get("hash"),
+	}
+
+	// The app_id launch parameter selects the app configuration
+	app, appKnown := appRegistry.Lookup(params.AppID)
+
+	// Verify the launch parameters, if any
+	var launchErr string
+	switch {
+	// Reject duplicated, malformed or oversized parameters (strict mode)
+	case strictErr != nil:
+		log.Printf("Rejected launch: %v", strictErr)
+		launchErr = "Invalid launch parameters: " + strictErr.Error()
+
+	// Check if required parameters are present
+	case params.Hash == "" || params.UserID == "":
+		launchErr = "Missing required parameters. This app must be opened from Ton.Place."
+
+	// Reject apps this server is not configured for
+	case !appKnown:
+		launchErr = "Unknown app. This server is not configured for this app_id."
+
+	// Validate timestamp and signature using ALL query parameters (not just the
+	// hardcoded ones). This is important because Ton.Place may send different sets
+	// of parameters. Every active secret is tried, so launches keep working during
+	// secret rotation.
+	default:
+		_, secretID, err := app.Verifier.VerifyWithSecretID(queryParams)
+		switch {
+		case errors.Is(err, ErrLaunchMissingParam):
+			launchErr = "Missing required parameters. This app must be opened from Ton.Place."
+		case errors.Is(err, ErrLaunchExpired), errors.Is(err, ErrLaunchFuture), errors.Is(err, ErrLaunchInvalidTimestamp):
+			launchErr = "Request expired or invalid timestamp. Please reopen the app from Ton.Place."
+		case err != nil:
+			launchErr = "Invalid signature. Request may have been tampered with."
+		case secretID != app.Verifier.Secrets[0].ID:
+			log.Printf("Launch of user %s in app %s signed with old secret %q", params.UserID, app.ID, secretID)
+		}
+		if err != nil {
+			log.Printf("Rejected launch of user %s in app %s: %v", params.UserID, app.ID, err)
+		}
+	}
+
+	userID, err := strconv.ParseInt(params.UserID, 10, 64)
+	if launchErr == "" && err != nil {
+		launchErr = "Invalid user ID."
+	}
+
+	// A still-valid session from an earlier launch of the same user and app in this browser
+	existing, sessionApp, sessionErr := sessionFromRequest(r)
+	hasSession := sessionErr == nil &&
+		(params.UserID == "" || params.UserID == strconv.FormatInt(existing.UserID, 10)) &&
+		(params.AppID == "" || params.AppID == existing.AppID)
+
+	var session Session
+	if launchErr == "" {
+		session, err = newSession(params, userID)
+		if err != nil {
+			log.Printf("Failed to create session: %v", err)
+			launchErr = "Internal error. Please try again."
+		}
+	}
+	if launchErr == "" {
+		// A reload in the same browser keeps its session ID
+		if hasSession {
+			session.ID = existing.ID
+		}
+		// Reject launch URLs that were already used by someone else
+		if err := launchReplayGuard.Check(params, session.ID); err != nil {
+			log.Printf("Rejected launch of user %d: %v", userID, err)
+			launchErr = "This launch link was already used. Please reopen the app from Ton.Place."
+		}
+	}
+
+	switch {
+	case launchErr == "":
+		// Fresh launch - start a new session, so reloads and API calls
+		// keep working after the launch signature expires
+		if err := setSessionCookie(w, session); err != nil {
+			log.Printf("Failed to create session: %v", err)
+		}
+		return &Auth{User: params, UserID: userID, App: app, Session: session}, params, ""
+
+	case hasSession:
+		// Page reload (launch signature expired or already used), page opened
+		// without launch parameters, or API call - the session cookie proves the
+		// user was verified earlier. Launch parameters of another user never fall
+		// back to the session.
+		return &Auth{
+			User:        existing.UserParams(),
+			UserID:      existing.UserID,
+			App:         sessionApp,
+			Session:     existing,
+			FromSession: true,
+		}, params, ""
+
+	case params.Hash == "" && sessionErr != errNoSession:
+		// No launch parameters and a session that is invalid or expired
+		log.Printf("Rejected session: %v", sessionErr)
+		return nil, params, "Your session has expired. Please reopen the app from Ton.Place."
+
+	default:
+		return nil, params, launchErr
+	}
+}
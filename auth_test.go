@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authApps registers two apps for the middleware tests.
+func authApps(t *testing.T) {
+	withApps(t,
+		&AppConfig{ID: "1", Secrets: []AppSecret{{ID: "current", Secret: "s1"}}},
+		&AppConfig{ID: "2", Secrets: []AppSecret{{ID: "current", Secret: "s2"}}},
+	)
+	withReplayGuard(t)
+}
+
+// launchQuery returns launch parameters of a user, signed with secret.
+func launchQuery(appID, userID, firstName, secret string) string {
+	q := url.Values{
+		"app_id":     {appID},
+		"user_id":    {userID},
+		"ts":         {strconv.FormatInt(time.Now().Unix(), 10)},
+		"first_name": {firstName},
+		"last_name":  {""},
+	}
+	q.Set("hash", SignParams(launchParams(q), secret))
+	return q.Encode()
+}
+
+// sessionCookie returns a valid session cookie of a user.
+func sessionCookie(t *testing.T, appID string, userID int64) *http.Cookie {
+	t.Helper()
+	value, err := encodeSession(Session{ID: "existing", AppID: appID, UserID: userID, FirstName: "Old", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: SESSION_COOKIE_NAME, Value: value}
+}
+
+func TestRequireTonPlaceUser(t *testing.T) {
+	authApps(t)
+
+	tests := []struct {
+		name        string
+		mode        AuthFailureMode
+		query       string
+		cookie      func(t *testing.T) *http.Cookie
+		wantCode    int
+		wantUser    string // Expected UserFromContext(...).UserID if next runs
+		wantName    string
+		wantApp     string
+		wantSession bool // Expected FromSession
+	}{
+		{
+			name:     "valid launch",
+			query:    launchQuery("1", "42", "Ada", "s1"),
+			wantCode: http.StatusOK, wantUser: "42", wantName: "Ada", wantApp: "1",
+		},
+		{
+			name:     "session without launch parameters",
+			cookie:   func(t *testing.T) *http.Cookie { return sessionCookie(t, "1", 42) },
+			wantCode: http.StatusOK, wantUser: "42", wantName: "Old", wantApp: "1", wantSession: true,
+		},
+		{
+			name:     "JSON mode without credentials",
+			mode:     RespondJSON,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "HTML mode with a bad signature",
+			query:    launchQuery("1", "42", "Ada", "wrong"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "launch of another user never uses the session",
+			query:    launchQuery("1", "43", "Eve", "wrong"),
+			cookie:   func(t *testing.T) *http.Cookie { return sessionCookie(t, "1", 42) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "launch of another app never uses the session",
+			query:    launchQuery("2", "42", "Ada", "wrong"),
+			cookie:   func(t *testing.T) *http.Cookie { return sessionCookie(t, "1", 42) },
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "valid launch of another user replaces the session",
+			query:    launchQuery("1", "43", "Eve", "s1"),
+			cookie:   func(t *testing.T) *http.Cookie { return sessionCookie(t, "1", 42) },
+			wantCode: http.StatusOK, wantUser: "43", wantName: "Eve", wantApp: "1",
+		},
+		{
+			name:     "valid launch of another app replaces the session",
+			query:    launchQuery("2", "42", "Ada", "s2"),
+			cookie:   func(t *testing.T) *http.Cookie { return sessionCookie(t, "1", 42) },
+			wantCode: http.StatusOK, wantUser: "42", wantName: "Ada", wantApp: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Auth
+			var gotUser UserParams
+			handler := RequireTonPlaceUser(tt.mode, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = AuthFromContext(r.Context())
+				gotUser, _ = UserFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie(t))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %.200s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				if got != nil {
+					t.Fatal("handler ran for an unauthenticated request")
+				}
+				if tt.mode == RespondJSON {
+					var body map[string]string
+					if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+						t.Errorf("body = %s, want a JSON error", rec.Body)
+					}
+					if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+						t.Errorf("Content-Type = %q", ct)
+					}
+				} else if !strings.Contains(rec.Body.String(), "<html") {
+					t.Errorf("body is not an HTML page: %.200s", rec.Body)
+				}
+				return
+			}
+
+			if gotUser.UserID != tt.wantUser || gotUser.FirstName != tt.wantName {
+				t.Errorf("UserFromContext = %+v, want user %s (%s)", gotUser, tt.wantUser, tt.wantName)
+			}
+			if got.App.ID != tt.wantApp || got.FromSession != tt.wantSession || got.Session.AppID != tt.wantApp {
+				t.Errorf("auth = %+v, want app %s, from session %v", got, tt.wantApp, tt.wantSession)
+			}
+			if !tt.wantSession && tt.cookie != nil && got.Session.ID == "existing" {
+				t.Error("launch of another user or app kept the old session ID")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+// ====================================================================================
+// PRODUCT CATALOG
+// ====================================================================================
+// Prices are defined on the server, never by the client. The browser only sends the
+// SKU of the product it wants to buy; the server looks up amount, currency and title
+// in the catalog and creates the purchase with those values.
+//
+// The catalog is loaded from a JSON file at startup (CATALOG_FILE):
+//
+//	{
+//	  "products": [
+//	    {"sku": "premium_feature", "title": "Premium Feature", "amount": 500,
+//	     "currency": "eur", "max_per_user": 1,
+//	     "grants": [{"key": "premium", "type": "permanent"}]}
+//	  ]
+//	}
+// ====================================================================================
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// CATALOG_FILE - Path of the product catalog, relative to the working directory
+const CATALOG_FILE = "catalog.json"
+
+// productCatalog - Products offered by the app, loaded in main
+var productCatalog = &Catalog{}
+
+// skuPattern - Allowed characters of a SKU
+var skuPattern = regexp.MustCompile(`^[a-z0-9_.-]{1,64}$`)
+
+// Product is one item users can buy.
+type Product struct {
+	// SKU - Unique product identifier sent by the client (e.g. "premium_feature")
+	SKU string `json:"sku"`
+
+	// Title - Purchase description shown in the payment dialog (max 150 characters)
+	Title string `json:"title"`
+
+	// Amount - Price in smallest currency unit (cents for EUR)
+	Amount int64 `json:"amount"`
+
+	// Currency - Currency code; currently only "eur" is supported
+	Currency string `json:"currency"`
+
+	// MaxPerUser - How many times one user may buy this product (0 = unlimited)
+	// Only paid purchases count, so cancelled payments don't use up the limit
+	MaxPerUser int `json:"max_per_user,omitempty"`
+
+	// Grants - Entitlements the user receives once the purchase is paid
+	Grants []Grant `json:"grants,omitempty"`
+}
+
+// Catalog is the set of products offered by the app. It is read-only after loading.
+type Catalog struct {
+	products []Product
+	bySKU    map[string]Product
+}
+
+// LoadCatalog reads and validates a catalog file.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var file struct {
+		Products []Product `json:"products"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+	}
+	return NewCatalog(file.Products)
+}
+
+// NewCatalog validates products and builds a catalog from them.
+func NewCatalog(products []Product) (*Catalog, error) {
+	c := &Catalog{bySKU: make(map[string]Product, len(products))}
+	grantTypes := make(map[string]string) // Entitlement key -> grant type
+	for _, p := range products {
+		switch {
+		case !skuPattern.MatchString(p.SKU):
+			return nil, fmt.Errorf("product %q: SKU must be 1-64 characters of a-z, 0-9, _ . -", p.SKU)
+		case p.Title == "" || len(p.Title) > 150:
+			return nil, fmt.Errorf("product %s: title is required and must be 150 characters or less", p.SKU)
+		case p.Amount <= 0:
+			return nil, fmt.Errorf("product %s: amount must be greater than 0", p.SKU)
+		case p.Currency != "eur":
+			return nil, fmt.Errorf("product %s: currency must be \"eur\"", p.SKU)
+		case p.MaxPerUser < 0:
+			return nil, fmt.Errorf("product %s: max_per_user must not be negative", p.SKU)
+		}
+		for i, g := range p.Grants {
+			if err := g.validate(); err != nil {
+				return nil, fmt.Errorf("product %s: grant %d: %w", p.SKU, i+1, err)
+			}
+			if t, ok := grantTypes[g.Key]; ok && t != g.Type {
+				return nil, fmt.Errorf("product %s: entitlement %s is granted as both %s and %s", p.SKU, g.Key, t, g.Type)
+			}
+			grantTypes[g.Key] = g.Type
+		}
+		if _, dup := c.bySKU[p.SKU]; dup {
+			return nil, fmt.Errorf("product %s is listed twice", p.SKU)
+		}
+		c.bySKU[p.SKU] = p
+		c.products = append(c.products, p)
+	}
+	return c, nil
+}
+
+// Lookup returns the product with the given SKU.
+func (c *Catalog) Lookup(sku string) (Product, bool) {
+	p, ok := c.bySKU[sku]
+	return p, ok
+}
+
+// Products returns all products in catalog file order.
+func (c *Catalog) Products() []Product {
+	return c.products
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewCatalogValidation(t *testing.T) {
+	valid := Product{SKU: "coins_100", Title: "100 Coins", Amount: 200, Currency: "eur"}
+	with := func(change func(*Product)) []Product {
+		p := valid
+		change(&p)
+		return []Product{p}
+	}
+
+	tests := []struct {
+		name     string
+		products []Product
+		wantErr  string
+	}{
+		{"valid", []Product{valid}, ""},
+		{"bad sku", with(func(p *Product) { p.SKU = "Coins 100" }), "SKU"},
+		{"no title", with(func(p *Product) { p.Title = "" }), "title"},
+		{"zero amount", with(func(p *Product) { p.Amount = 0 }), "amount"},
+		{"other currency", with(func(p *Product) { p.Currency = "ton" }), "currency"},
+		{"negative limit", with(func(p *Product) { p.MaxPerUser = -1 }), "max_per_user"},
+		{"duplicate sku", []Product{valid, valid}, "twice"},
+		{"bad grant", with(func(p *Product) { p.Grants = []Grant{{Key: "vip", Type: GrantTimed, Duration: "soon"}} }), "grant 1"},
+		{"grant type conflict", []Product{
+			with(func(p *Product) { p.Grants = []Grant{{Key: "vip", Type: GrantPermanent}} })[0],
+			with(func(p *Product) {
+				p.SKU = "vip_month"
+				p.Grants = []Grant{{Key: "vip", Type: GrantTimed, Duration: "720h"}}
+			})[0],
+		}, "both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCatalog(tt.products)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxPerUserCountsOnlyPaidPurchases(t *testing.T) {
+	srv, app := testApp(t)
+	buy := func() string {
+		rec := httptest.NewRecorder()
+		handleCreatePurchase(rec, purchaseRequest(context.Background(), app, 5, `{"sku":"once"}`, ""))
+		return rec.Body.String()
+	}
+
+	// The user opens the payment dialog and cancels: the purchase stays pending
+	if body := buy(); !strings.Contains(body, "purchase_id") {
+		t.Fatalf("first purchase: %s", body)
+	}
+
+	// Buying again must still work, and this time the user pays
+	body := buy()
+	if !strings.Contains(body, `"purchase_id":2`) {
+		t.Fatalf("purchase after a cancelled payment: %s", body)
+	}
+	srv.MarkPaid(2)
+
+	// "once" has max_per_user 1
+	if body := buy(); !strings.Contains(body, "can't buy this product again") {
+		t.Fatalf("purchase after paying: %s, want limit error", body)
+	}
+}
+
+func TestDemoCatalogIsValid(t *testing.T) {
+	// Tests use testProducts; only check that the shipped catalog loads
+	if _, err := LoadCatalog(CATALOG_FILE); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+// ====================================================================================
+// ENTITLEMENTS
+// ====================================================================================
+// A purchase is only worth something if the user gets what they paid for. Catalog
+// products list grants, and when a purchase becomes paid its grants are applied to
+// the buyer:
+//
+//   - permanent  - A feature the user owns forever (e.g. "premium")
+//   - consumable - A quantity that adds up and is used up by Consume (e.g. coins)
+//   - timed      - Access for a duration; buying again extends it (e.g. 30 days VIP)
+//
+// Grants are applied by a reconciler callback, so they also arrive when the user
+// closed the app mid-payment. Each purchase is applied exactly once: the store
+// remembers applied purchases and ignores them when they are reported again.
+//
+// Handlers check what a user owns with:
+//
+//	if EntitlementsFor(auth.App.ID).HasEntitlement(auth.UserID, "premium") {
+//	    ...
+//	}
+// ====================================================================================
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// ENTITLEMENTS_FILE - Where FileEntitlementStore keeps entitlements
+const ENTITLEMENTS_FILE = "entitlements.json"
+
+// Grant types
+const (
+	// GrantPermanent - Owned forever
+	GrantPermanent = "permanent"
+
+	// GrantConsumable - Quantity that is used up
+	GrantConsumable = "consumable"
+
+	// GrantTimed - Access until a point in time
+	GrantTimed = "timed"
+)
+
+// ErrNotEntitled - The user has no active entitlement with that key
+var ErrNotEntitled = errors.New("not entitled")
+
+// ErrInsufficientQuantity - The user doesn't have enough of a consumable
+var ErrInsufficientQuantity = errors.New("insufficient quantity")
+
+// entitlementStore holds the entitlements of all users.
+// main replaces it with a FileEntitlementStore.
+var entitlementStore EntitlementStore = NewMemoryEntitlementStore()
+
+// Grant is an entitlement a product gives to its buyer.
+type Grant struct {
+	// Key - Name of the entitlement, checked by HasEntitlement (e.g. "premium")
+	Key string `json:"key"`
+
+	// Type - GrantPermanent, GrantConsumable or GrantTimed
+	Type string `json:"type"`
+
+	// Quantity - Amount added per purchase (consumable only)
+	Quantity int64 `json:"quantity,omitempty"`
+
+	// Duration - Access added per purchase, e.g. "720h" (timed only)
+	Duration string `json:"duration,omitempty"`
+}
+
+// validate checks a grant from the catalog file.
+func (g Grant) validate() error {
+	if !skuPattern.MatchString(g.Key) {
+		return fmt.Errorf("key %q must be 1-64 characters of a-z, 0-9, _ . -", g.Key)
+	}
+	switch g.Type {
+	case GrantPermanent:
+		if g.Quantity != 0 || g.Duration != "" {
+			return errors.New("permanent grants take no quantity or duration")
+		}
+	case GrantConsumable:
+		if g.Quantity <= 0 || g.Duration != "" {
+			return errors.New("consumable grants need a quantity greater than 0 and no duration")
+		}
+	case GrantTimed:
+		d, err := time.ParseDuration(g.Duration)
+		if err != nil || d <= 0 || g.Quantity != 0 {
+			return errors.New(`timed grants need a positive duration such as "720h" and no quantity`)
+		}
+	default:
+		return fmt.Errorf("type must be %q, %q or %q", GrantPermanent, GrantConsumable, GrantTimed)
+	}
+	return nil
+}
+
+// duration returns the parsed Duration of a validated timed grant.
+func (g Grant) duration() time.Duration {
+	d, _ := time.ParseDuration(g.Duration)
+	return d
+}
+
+// Entitlement is what a user of an app owns for one key.
+type Entitlement struct {
+	// AppID, UserID - Owner of the entitlement
+	AppID  string `json:"app_id"`
+	UserID int64  `json:"user_id"`
+
+	// Key, Type - From the grant
+	Key  string `json:"key"`
+	Type string `json:"type"`
+
+	// Quantity - Remaining quantity (consumable only)
+	Quantity int64 `json:"quantity,omitempty"`
+
+	// ExpiresAt - Unix timestamp when access ends (timed only)
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
+	// UpdatedAt - Unix timestamp of the last grant or consumption
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Active reports whether the entitlement currently gives access.
+func (e Entitlement) Active(now time.Time) bool {
+	switch e.Type {
+	case GrantPermanent:
+		return true
+	case GrantConsumable:
+		return e.Quantity > 0
+	case GrantTimed:
+		return now.Unix() < e.ExpiresAt
+	}
+	return false
+}
+
+// EntitlementStore keeps entitlements and the purchases that were applied.
+// Implementations must be safe for concurrent use.
+type EntitlementStore interface {
+	// Grant applies the grants of a paid purchase to its buyer. Each purchase is
+	// applied at most once: if it already was, nothing changes and applied is false.
+	Grant(appID string, userID, purchaseID int64, grants []Grant, at time.Time) (applied bool, err error)
+
+	// ForUser returns all entitlements of a user in an app, sorted by key,
+	// including used-up and expired ones.
+	ForUser(appID string, userID int64) ([]Entitlement, error)
+
+	// Consume takes n from a consumable entitlement and returns the remaining quantity.
+	// It returns ErrNotEntitled if the user has no such consumable and
+	// ErrInsufficientQuantity if less than n is left.
+	Consume(appID string, userID int64, key string, n int64, at time.Time) (remaining int64, err error)
+}
+
+// ====================================================================================
+// GO API FOR HANDLERS
+// ====================================================================================
+
+// Entitlements answers what the users of one app own.
+type Entitlements struct {
+	// AppID - App whose entitlements are checked
+	AppID string
+
+	// Store - Where entitlements are kept
+	Store EntitlementStore
+
+	now func() time.Time
+}
+
+// EntitlementsFor returns the entitlements of an app's users.
+func EntitlementsFor(appID string) *Entitlements {
+	return &Entitlements{AppID: appID, Store: entitlementStore, now: time.Now}
+}
+
+// HasEntitlement reports whether the user currently has an active entitlement
+// with the given key: owned permanently, with quantity left, or not expired.
+// Store errors are logged and treated as not entitled.
+func (e *Entitlements) HasEntitlement(userID int64, key string) bool {
+	list, err := e.Store.ForUser(e.AppID, userID)
+	if err != nil {
+		log.Printf("Failed to load entitlements of user %d: %v", userID, err)
+		return false
+	}
+	now := e.now()
+	for _, ent := range list {
+		if ent.Key == key && ent.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns all entitlements of the user, including inactive ones.
+func (e *Entitlements) List(userID int64) ([]Entitlement, error) {
+	return e.Store.ForUser(e.AppID, userID)
+}
+
+// Consume takes n from the user's consumable entitlement key.
+func (e *Entitlements) Consume(userID int64, key string, n int64) (remaining int64, err error) {
+	return e.Store.Consume(e.AppID, userID, key, n, e.now())
+}
+
+// ====================================================================================
+// GRANTING
+// ====================================================================================
+
+// grantEntitlements is a TransitionFunc applying the grants of purchases that became paid.
+func grantEntitlements(_ context.Context, t PurchaseTransition) error {
+	if t.To != tonplace.StatusPaid {
+		return nil
+	}
+	return applyPurchaseGrants(t.Record)
+}
+
+// applyPurchaseGrants applies the catalog grants of a paid purchase, once.
+// Purchases of products without grants are recorded as applied as well, so grants
+// added to the catalog later don't apply to old purchases.
+func applyPurchaseGrants(rec PurchaseRecord) error {
+	product, ok := productCatalog.Lookup(rec.SKU)
+	if !ok {
+		return fmt.Errorf("purchase %d: product %q is not in the catalog", rec.PurchaseID, rec.SKU)
+	}
+	at := time.Unix(rec.PaidAt, 0)
+	if rec.PaidAt == 0 {
+		at = time.Now()
+	}
+	applied, err := entitlementStore.Grant(rec.AppID, rec.UserID, rec.PurchaseID, product.Grants, at)
+	if err != nil {
+		return fmt.Errorf("purchase %d: %w", rec.PurchaseID, err)
+	}
+	if applied && len(product.Grants) > 0 {
+		log.Printf("Granted %s to user %d (purchase %d)", product.SKU, rec.UserID, rec.PurchaseID)
+	}
+	return nil
+}
+
+// applyPaidPurchases applies grants of paid purchases in the ledger that were
+// never applied, e.g. because the server stopped right after recording the payment.
+func applyPaidPurchases(store PurchaseStore) error {
+	paid, err := store.ByStatus(tonplace.StatusPaid)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, rec := range paid {
+		if err := applyPurchaseGrants(rec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ====================================================================================
+// HTTP HANDLER
+// ====================================================================================
+
+// EntitlementStatus is an entitlement as shown to the client.
+type EntitlementStatus struct {
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	Quantity  int64  `json:"quantity,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Active    bool   `json:"active"`
+}
+
+// entitlementStatuses converts entitlements for display.
+func entitlementStatuses(list []Entitlement, now time.Time) []EntitlementStatus {
+	out := make([]EntitlementStatus, 0, len(list))
+	for _, e := range list {
+		out = append(out, EntitlementStatus{
+			Key:       e.Key,
+			Type:      e.Type,
+			Quantity:  e.Quantity,
+			ExpiresAt: e.ExpiresAt,
+			Active:    e.Active(now),
+		})
+	}
+	return out
+}
+
+// handleGetEntitlements returns what the authenticated user owns.
+func handleGetEntitlements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	auth, _ := AuthFromContext(r.Context())
+	list, err := EntitlementsFor(auth.App.ID).List(auth.UserID)
+	if err != nil {
+		log.Printf("Failed to load entitlements of user %d: %v", auth.UserID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load entitlements"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"entitlements": entitlementStatuses(list, time.Now())})
+}
+
+// ====================================================================================
+// IN-MEMORY ENTITLEMENT STORE
+// ====================================================================================
+
+// entitlementKey identifies an entitlement.
+type entitlementKey struct {
+	appID  string
+	userID int64
+	key    string
+}
+
+// MemoryEntitlementStore is an EntitlementStore keeping everything in process memory.
+type MemoryEntitlementStore struct {
+	mu           sync.RWMutex
+	entitlements map[entitlementKey]Entitlement
+	applied      map[purchaseKey]bool
+}
+
+// NewMemoryEntitlementStore creates an empty in-memory entitlement store.
+func NewMemoryEntitlementStore() *MemoryEntitlementStore {
+	return &MemoryEntitlementStore{
+		entitlements: make(map[entitlementKey]Entitlement),
+		applied:      make(map[purchaseKey]bool),
+	}
+}
+
+// Grant implements EntitlementStore.
+func (s *MemoryEntitlementStore) Grant(appID string, userID, purchaseID int64, grants []Grant, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	applied, _, err := s.grant(appID, userID, purchaseID, grants, at)
+	return applied, err
+}
+
+// grant applies grants and returns a function undoing the change.
+// The caller must hold s.mu.
+func (s *MemoryEntitlementStore) grant(appID string, userID, purchaseID int64, grants []Grant, at time.Time) (bool, func(), error) {
+	pk := purchaseKey{appID, purchaseID}
+	if s.applied[pk] {
+		return false, nil, nil
+	}
+
+	// Check all grants first, so a conflict changes nothing
+	for _, g := range grants {
+		if e, ok := s.entitlements[entitlementKey{appID, userID, g.Key}]; ok && e.Type != g.Type {
+			return false, nil, fmt.Errorf("entitlement %s is %s, can't grant it as %s", g.Key, e.Type, g.Type)
+		}
+	}
+
+	old := make(map[entitlementKey]*Entitlement, len(grants))
+	for _, g := range grants {
+		key := entitlementKey{appID, userID, g.Key}
+		e, ok := s.entitlements[key]
+		if _, saved := old[key]; !saved {
+			if ok {
+				prev := e
+				old[key] = &prev
+			} else {
+				old[key] = nil
+			}
+		}
+		if !ok {
+			e = Entitlement{AppID: appID, UserID: userID, Key: g.Key, Type: g.Type}
+		}
+		switch g.Type {
+		case GrantConsumable:
+			e.Quantity += g.Quantity
+		case GrantTimed:
+			start := at.Unix()
+			if e.ExpiresAt > start {
+				start = e.ExpiresAt // Extend running access
+			}
+			e.ExpiresAt = start + int64(g.duration()/time.Second)
+		}
+		e.UpdatedAt = at.Unix()
+		s.entitlements[key] = e
+	}
+	s.applied[pk] = true
+
+	undo := func() {
+		delete(s.applied, pk)
+		for key, prev := range old {
+			if prev == nil {
+				delete(s.entitlements, key)
+			} else {
+				s.entitlements[key] = *prev
+			}
+		}
+	}
+	return true, undo, nil
+}
+
+// ForUser implements EntitlementStore.
+func (s *MemoryEntitlementStore) ForUser(appID string, userID int64) ([]Entitlement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Entitlement{}
+	for _, e := range s.entitlements {
+		if e.AppID == appID && e.UserID == userID {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Consume implements EntitlementStore.
+func (s *MemoryEntitlementStore) Consume(appID string, userID int64, key string, n int64, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining, _, err := s.consume(appID, userID, key, n, at)
+	return remaining, err
+}
+
+// consume takes n from a consumable and returns a function undoing the change.
+// The caller must hold s.mu.
+func (s *MemoryEntitlementStore) consume(appID string, userID int64, key string, n int64, at time.Time) (int64, func(), error) {
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("quantity to consume must be greater than 0")
+	}
+	k := entitlementKey{appID, userID, key}
+	e, ok := s.entitlements[k]
+	if !ok || e.Type != GrantConsumable {
+		return 0, nil, ErrNotEntitled
+	}
+	if e.Quantity < n {
+		return e.Quantity, nil, ErrInsufficientQuantity
+	}
+	prev := e
+	e.Quantity -= n
+	e.UpdatedAt = at.Unix()
+	s.entitlements[k] = e
+	return e.Quantity, func() { s.entitlements[k] = prev }, nil
+}
+
+// ====================================================================================
+// FILE-BACKED ENTITLEMENT STORE
+// ====================================================================================
+
+// FileEntitlementStore is an EntitlementStore that keeps everything in memory and
+// rewrites a JSON file after every change, like FilePurchaseStore.
+// Only one process may use a file at a time.
+type FileEntitlementStore struct {
+	mem  *MemoryEntitlementStore
+	path string
+}
+
+// entitlementsFile is the on-disk format of FileEntitlementStore.
+type entitlementsFile struct {
+	Entitlements []Entitlement     `json:"entitlements"`
+	Applied      []appliedPurchase `json:"applied_purchases"`
+}
+
+// appliedPurchase is a purchase whose grants were applied.
+type appliedPurchase struct {
+	AppID      string `json:"app_id"`
+	PurchaseID int64  `json:"purchase_id"`
+}
+
+// OpenFileEntitlementStore loads the entitlements at path. A missing file is
+// treated as empty and created on the first change.
+func OpenFileEntitlementStore(path string) (*FileEntitlementStore, error) {
+	s := &FileEntitlementStore{mem: NewMemoryEntitlementStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entitlements: %w", err)
+	}
+
+	var file entitlementsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse entitlements %s: %w", path, err)
+	}
+	for _, e := range file.Entitlements {
+		s.mem.entitlements[entitlementKey{e.AppID, e.UserID, e.Key}] = e
+	}
+	for _, a := range file.Applied {
+		s.mem.applied[purchaseKey{a.AppID, a.PurchaseID}] = true
+	}
+	return s, nil
+}
+
+// Grant implements EntitlementStore.
+func (s *FileEntitlementStore) Grant(appID string, userID, purchaseID int64, grants []Grant, at time.Time) (bool, error) {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	applied, undo, err := s.mem.grant(appID, userID, purchaseID, grants, at)
+	if err != nil || !applied {
+		return false, err
+	}
+	if err := s.save(); err != nil {
+		undo()
+		return false, err
+	}
+	return true, nil
+}
+
+// ForUser implements EntitlementStore.
+func (s *FileEntitlementStore) ForUser(appID string, userID int64) ([]Entitlement, error) {
+	return s.mem.ForUser(appID, userID)
+}
+
+// Consume implements EntitlementStore.
+func (s *FileEntitlementStore) Consume(appID string, userID int64, key string, n int64, at time.Time) (int64, error) {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	remaining, undo, err := s.mem.consume(appID, userID, key, n, at)
+	if err != nil {
+		return remaining, err
+	}
+	if err := s.save(); err != nil {
+		undo()
+		return 0, err
+	}
+	return remaining, nil
+}
+
+// save writes everything to the file. The caller must hold s.mem.mu.
+func (s *FileEntitlementStore) save() error {
+	file := entitlementsFile{
+		Entitlements: make([]Entitlement, 0, len(s.mem.entitlements)),
+		Applied:      make([]appliedPurchase, 0, len(s.mem.applied)),
+	}
+	for _, e := range s.mem.entitlements {
+		file.Entitlements = append(file.Entitlements, e)
+	}
+	sort.Slice(file.Entitlements, func(i, j int) bool {
+		a, b := file.Entitlements[i], file.Entitlements[j]
+		if a.AppID != b.AppID {
+			return a.AppID < b.AppID
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.Key < b.Key
+	})
+	for pk := range s.mem.applied {
+		file.Applied = append(file.Applied, appliedPurchase{AppID: pk.appID, PurchaseID: pk.purchaseID})
+	}
+	sort.Slice(file.Applied, func(i, j int) bool {
+		a, b := file.Applied[i], file.Applied[j]
+		if a.AppID != b.AppID {
+			return a.AppID < b.AppID
+		}
+		return a.PurchaseID < b.PurchaseID
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write entitlements: %w", err)
+	}
+	return nil
+}
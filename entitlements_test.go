@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+func TestMemoryEntitlementStoreGrant(t *testing.T) {
+	at := time.Unix(1_000_000, 0)
+	day := int64(24 * 60 * 60)
+	premium := Grant{Key: "premium", Type: GrantPermanent}
+	coins := Grant{Key: "coins", Type: GrantConsumable, Quantity: 100}
+	vip := Grant{Key: "vip", Type: GrantTimed, Duration: "24h"}
+
+	type grantCall struct {
+		purchaseID int64
+		grants     []Grant
+		at         time.Time
+	}
+	tests := []struct {
+		name        string
+		calls       []grantCall
+		wantApplied []bool
+		want        map[string]Entitlement // By key; only Quantity and ExpiresAt are compared
+	}{
+		{
+			name:        "permanent",
+			calls:       []grantCall{{1, []Grant{premium}, at}},
+			wantApplied: []bool{true},
+			want:        map[string]Entitlement{"premium": {}},
+		},
+		{
+			name:        "consumables add up",
+			calls:       []grantCall{{1, []Grant{coins}, at}, {2, []Grant{coins}, at}},
+			wantApplied: []bool{true, true},
+			want:        map[string]Entitlement{"coins": {Quantity: 200}},
+		},
+		{
+			name:        "same purchase is applied once",
+			calls:       []grantCall{{1, []Grant{coins}, at}, {1, []Grant{coins}, at}},
+			wantApplied: []bool{true, false},
+			want:        map[string]Entitlement{"coins": {Quantity: 100}},
+		},
+		{
+			name:        "timed access is extended while running",
+			calls:       []grantCall{{1, []Grant{vip}, at}, {2, []Grant{vip}, at.Add(time.Hour)}},
+			wantApplied: []bool{true, true},
+			want:        map[string]Entitlement{"vip": {ExpiresAt: at.Unix() + 2*day}},
+		},
+		{
+			name:        "expired timed access starts again",
+			calls:       []grantCall{{1, []Grant{vip}, at}, {2, []Grant{vip}, at.Add(48 * time.Hour)}},
+			wantApplied: []bool{true, true},
+			want:        map[string]Entitlement{"vip": {ExpiresAt: at.Unix() + 3*day}},
+		},
+		{
+			name:        "purchase without grants is recorded",
+			calls:       []grantCall{{1, nil, at}, {1, []Grant{premium}, at}},
+			wantApplied: []bool{true, false},
+			want:        map[string]Entitlement{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryEntitlementStore()
+			for i, c := range tt.calls {
+				applied, err := s.Grant("1", 5, c.purchaseID, c.grants, c.at)
+				if err != nil {
+					t.Fatalf("call %d: %v", i, err)
+				}
+				if applied != tt.wantApplied[i] {
+					t.Errorf("call %d: applied = %v, want %v", i, applied, tt.wantApplied[i])
+				}
+			}
+
+			list, _ := s.ForUser("1", 5)
+			if len(list) != len(tt.want) {
+				t.Fatalf("got %d entitlements, want %d: %+v", len(list), len(tt.want), list)
+			}
+			for _, e := range list {
+				want, ok := tt.want[e.Key]
+				if !ok {
+					t.Fatalf("unexpected entitlement %q", e.Key)
+				}
+				if e.Quantity != want.Quantity || e.ExpiresAt != want.ExpiresAt {
+					t.Errorf("%s: quantity=%d expires_at=%d, want %d and %d", e.Key, e.Quantity, e.ExpiresAt, want.Quantity, want.ExpiresAt)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryEntitlementStoreGrantConflictChangesNothing(t *testing.T) {
+	s := NewMemoryEntitlementStore()
+	at := time.Unix(1_000_000, 0)
+	s.Grant("1", 5, 1, []Grant{{Key: "vip", Type: GrantPermanent}}, at)
+
+	_, err := s.Grant("1", 5, 2, []Grant{
+		{Key: "coins", Type: GrantConsumable, Quantity: 100},
+		{Key: "vip", Type: GrantTimed, Duration: "24h"},
+	}, at)
+	if err == nil {
+		t.Fatal("granting a key with another type succeeded")
+	}
+	list, _ := s.ForUser("1", 5)
+	if len(list) != 1 {
+		t.Errorf("got %+v, want only the original entitlement", list)
+	}
+	if applied, _ := s.Grant("1", 5, 2, nil, at); !applied {
+		t.Error("failed purchase was recorded as applied")
+	}
+}
+
+func TestEntitlementsConsume(t *testing.T) {
+	s := NewMemoryEntitlementStore()
+	s.Grant("1", 5, 1, []Grant{{Key: "coins", Type: GrantConsumable, Quantity: 10}, {Key: "premium", Type: GrantPermanent}}, time.Now())
+	ent := &Entitlements{AppID: "1", Store: s, now: time.Now}
+
+	tests := []struct {
+		key     string
+		n       int64
+		want    int64
+		wantErr error
+	}{
+		{"coins", 4, 6, nil},
+		{"coins", 7, 6, ErrInsufficientQuantity},
+		{"coins", 6, 0, nil},
+		{"premium", 1, 0, ErrNotEntitled},
+		{"gems", 1, 0, ErrNotEntitled},
+	}
+	for _, tt := range tests {
+		got, err := ent.Consume(5, tt.key, tt.n)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Consume(%s, %d) = %d, %v; want %d, %v", tt.key, tt.n, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if ent.HasEntitlement(5, "coins") {
+		t.Error("used-up consumable is still active")
+	}
+	if !ent.HasEntitlement(5, "premium") || ent.HasEntitlement(6, "premium") {
+		t.Error("HasEntitlement doesn't match the granted user")
+	}
+}
+
+func TestPaidTransitionGrantsOnce(t *testing.T) {
+	_, app := testApp(t)
+	purchaseLedger.Add(PurchaseRecord{PurchaseID: 1, AppID: app.ID, UserID: 5, SKU: "coins_100", Status: tonplace.StatusPending})
+	purchaseReconciler.OnTransition(grantEntitlements)
+
+	// Seen by a page load, the reconciler and the startup catch-up
+	paid := []tonplace.Transaction{{ID: 1, Status: tonplace.StatusPaid}}
+	purchaseReconciler.Observe(context.Background(), app.ID, paid)
+	purchaseReconciler.Observe(context.Background(), app.ID, paid)
+	if err := applyPaidPurchases(purchaseLedger); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := EntitlementsFor(app.ID).List(5)
+	if len(list) != 1 || list[0].Quantity != 100 {
+		t.Errorf("entitlements = %+v, want 100 coins", list)
+	}
+}
@@ -1 +1,3 @@
 module tonplace_app_demo
+
+go 1.23
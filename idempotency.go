@@ -0,0 +1,179 @@
+package main
+
+// ====================================================================================
+// IDEMPOTENCY KEYS
+// ====================================================================================
+// A double-click or a retried request must not create two purchases. Clients send
+// an Idempotency-Key header with /api/create-purchase; all requests with the same
+// key get the same purchase:
+//
+//   - The first request creates the purchase and remembers the result for
+//     IDEMPOTENCY_KEY_TTL
+//   - A repeated request returns the remembered purchase_id without calling
+//     Ton.Place again. If the first request is still running, it waits for it
+//   - A repeated key with a different payload is rejected
+//   - If the first request fails, the key is released and may be used again
+//   - The first request finishes even if its client disconnects, because the
+//     purchase may already exist at Ton.Place when the connection drops
+//
+// Keys are scoped to the app and user, so users can't see each other's purchases
+// by guessing keys. Results are kept in process memory: after a restart, or with
+// several server instances, a repeated key creates a new purchase.
+// ====================================================================================
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDEMPOTENCY_KEY_TTL - How long the result of a request is remembered
+const IDEMPOTENCY_KEY_TTL = 24 * time.Hour
+
+// IDEMPOTENT_CREATE_TIMEOUT - How long the first request with a key may take to create
+// the purchase. It keeps running when the client disconnects, so a retry with the same
+// key gets its result instead of creating a second purchase.
+const IDEMPOTENT_CREATE_TIMEOUT = 30 * time.Second
+
+// MAX_IDEMPOTENCY_KEY_LEN - Maximum length of an Idempotency-Key header
+const MAX_IDEMPOTENCY_KEY_LEN = 255
+
+// errIdempotencyKeyReused - The key was already used with a different payload
+var errIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// errBadIdempotencyKey - The key is empty, too long or contains invalid characters
+var errBadIdempotencyKey = errors.New("invalid Idempotency-Key header")
+
+// purchaseIdempotency deduplicates /api/create-purchase requests.
+var purchaseIdempotency = NewIdempotencyStore(IDEMPOTENCY_KEY_TTL)
+
+// idempotencyEntry is one key, in flight or completed.
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{} // Closed when the first request finished
+	ok          bool          // First request succeeded; valid after done is closed
+	purchaseID  int64         // Result of the first request; valid if ok
+	expiresAt   time.Time     // Zero while in flight
+}
+
+// IdempotencyStore remembers the purchase created for each idempotency key.
+// It is safe for concurrent use.
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	ttl       time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewIdempotencyStore creates a store remembering results for ttl.
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Do runs create once per key. fingerprint describes the request payload.
+//
+// The first call for a key runs create. Later calls with the same fingerprint
+// return its purchase ID with replayed == true; if create is still running, they
+// wait for it or until ctx is done. Calls with a different fingerprint return
+// errIdempotencyKeyReused. If create fails, its error is returned and the key is
+// released, so a later call runs create again.
+func (s *IdempotencyStore) Do(ctx context.Context, key, fingerprint string, create func() (int64, error)) (purchaseID int64, replayed bool, err error) {
+	for {
+		s.mu.Lock()
+		now := s.now()
+		s.sweep(now)
+
+		e, ok := s.entries[key]
+		if ok && !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+			ok = false // Expired but not yet swept
+		}
+		if !ok {
+			e = &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+			s.entries[key] = e
+			s.mu.Unlock()
+			return s.run(key, e, create)
+		}
+		s.mu.Unlock()
+
+		if e.fingerprint != fingerprint {
+			return 0, false, errIdempotencyKeyReused
+		}
+
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return 0, false, ctx.Err()
+		}
+		if e.ok {
+			return e.purchaseID, true, nil
+		}
+		// The first request failed and released the key - try again
+	}
+}
+
+// run calls create for a new entry and publishes the result.
+func (s *IdempotencyStore) run(key string, e *idempotencyEntry, create func() (int64, error)) (int64, bool, error) {
+	purchaseID, err := create()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		delete(s.entries, key)
+	} else {
+		e.ok = true
+		e.purchaseID = purchaseID
+		e.expiresAt = s.now().Add(s.ttl)
+	}
+	close(e.done)
+	return purchaseID, false, err
+}
+
+// sweep removes expired entries, at most once per replaySweepInterval.
+// The caller must hold s.mu.
+func (s *IdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < replaySweepInterval {
+		return
+	}
+	for k, e := range s.entries {
+		if !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
+
+// idempotencyScope builds the store key for a client key, scoped to app and user.
+func idempotencyScope(appID string, userID int64, key string) string {
+	return appID + ":" + strconv.FormatInt(userID, 10) + ":" + key
+}
+
+// idempotencyFingerprint hashes the fields of a request that determine the purchase.
+func idempotencyFingerprint(fields ...string) string {
+	h := sha256.New()
+	for _, f := range fields {
+		h.Write([]byte(strconv.Itoa(len(f)) + ":" + f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validIdempotencyKey checks that a key is 1-MAX_IDEMPOTENCY_KEY_LEN printable ASCII characters.
+func validIdempotencyKey(key string) error {
+	if key == "" || len(key) > MAX_IDEMPOTENCY_KEY_LEN {
+		return errBadIdempotencyKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return errBadIdempotencyKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStoreDo(t *testing.T) {
+	errCreate := errors.New("create failed")
+
+	tests := []struct {
+		name         string
+		calls        []string // Fingerprint of each call, in order
+		failFirst    bool
+		wantCreates  int32
+		wantReplayed []bool
+		wantErr      []error
+	}{
+		{
+			name:         "repeated key replays the result",
+			calls:        []string{"a", "a", "a"},
+			wantCreates:  1,
+			wantReplayed: []bool{false, true, true},
+			wantErr:      []error{nil, nil, nil},
+		},
+		{
+			name:         "different payload is rejected",
+			calls:        []string{"a", "b"},
+			wantCreates:  1,
+			wantReplayed: []bool{false, false},
+			wantErr:      []error{nil, errIdempotencyKeyReused},
+		},
+		{
+			name:         "failure releases the key",
+			calls:        []string{"a", "a", "a"},
+			failFirst:    true,
+			wantCreates:  2,
+			wantReplayed: []bool{false, false, true},
+			wantErr:      []error{errCreate, nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewIdempotencyStore(time.Hour)
+			var creates atomic.Int32
+			create := func() (int64, error) {
+				if creates.Add(1) == 1 && tt.failFirst {
+					return 0, errCreate
+				}
+				return 42, nil
+			}
+			for i, fp := range tt.calls {
+				id, replayed, err := s.Do(context.Background(), "key", fp, create)
+				if !errors.Is(err, tt.wantErr[i]) {
+					t.Fatalf("call %d: err = %v, want %v", i, err, tt.wantErr[i])
+				}
+				if replayed != tt.wantReplayed[i] {
+					t.Errorf("call %d: replayed = %v, want %v", i, replayed, tt.wantReplayed[i])
+				}
+				if err == nil && id != 42 {
+					t.Errorf("call %d: purchase ID = %d, want 42", i, id)
+				}
+			}
+			if got := creates.Load(); got != tt.wantCreates {
+				t.Errorf("create called %d times, want %d", got, tt.wantCreates)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreConcurrentCallsWait(t *testing.T) {
+	s := NewIdempotencyStore(time.Hour)
+	var creates atomic.Int32
+	release := make(chan struct{})
+	create := func() (int64, error) {
+		creates.Add(1)
+		<-release
+		return 7, nil
+	}
+
+	var wg sync.WaitGroup
+	ids := make([]int64, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[i], _, _ = s.Do(context.Background(), "key", "fp", create)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := creates.Load(); got != 1 {
+		t.Errorf("create called %d times, want 1", got)
+	}
+	for i, id := range ids {
+		if id != 7 {
+			t.Errorf("call %d: purchase ID = %d, want 7", i, id)
+		}
+	}
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	s := NewIdempotencyStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	var creates int
+	create := func() (int64, error) { creates++; return int64(creates), nil }
+
+	s.Do(context.Background(), "key", "a", create)
+	now = now.Add(2 * time.Hour)
+	id, replayed, err := s.Do(context.Background(), "key", "b", create)
+	if err != nil || replayed || id != 2 {
+		t.Fatalf("after TTL: id=%d replayed=%v err=%v, want a new purchase", id, replayed, err)
+	}
+}
+
+func TestCreatePurchaseSurvivesClientDisconnect(t *testing.T) {
+	srv, app := testApp(t)
+	srv.SetLatency(100 * time.Millisecond)
+
+	// The first request's client goes away while Ton.Place is creating the purchase
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	first := httptest.NewRecorder()
+	handleCreatePurchase(first, purchaseRequest(ctx, app, 5, `{"sku":"basic"}`, "retry-key"))
+
+	// Its retry with the same key must get the same purchase
+	retry := httptest.NewRecorder()
+	handleCreatePurchase(retry, purchaseRequest(context.Background(), app, 5, `{"sku":"basic"}`, "retry-key"))
+
+	if !strings.Contains(retry.Body.String(), `"purchase_id":1`) {
+		t.Fatalf("retry response = %s, want purchase 1", retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry was not marked as replayed")
+	}
+	if n := len(srv.Purchases()); n != 1 {
+		t.Errorf("Ton.Place has %d purchases, want 1", n)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+// ====================================================================================
+// STRICT LAUNCH PARAMETER PARSING
+// ====================================================================================
+// Go's URL parsing is lenient: a repeated key keeps all values (and the signature
+// check only looks at the first one), malformed pairs are silently dropped and
+// any value size is accepted. An attacker could use this to make the verified
+// value differ from the one the app later reads.
+//
+// In strict mode the raw query string is checked BEFORE the signature is computed.
+// A launch is rejected if it has:
+//   - a malformed query string (bad percent-encoding, ";" separators)
+//   - an empty key, or the same key more than once
+//   - a non-numeric app_id, user_id or ts
+//   - more than MAX_LAUNCH_PARAMS parameters, or a value longer than MAX_LAUNCH_PARAM_LEN
+// ====================================================================================
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// STRICT_LAUNCH_PARAMS - Reject ambiguous or malformed launch query strings
+	STRICT_LAUNCH_PARAMS = true
+
+	// MAX_LAUNCH_PARAMS - Maximum number of launch parameters
+	MAX_LAUNCH_PARAMS = 32
+
+	// MAX_LAUNCH_PARAM_LEN - Maximum length of a single launch parameter value, in bytes
+	MAX_LAUNCH_PARAM_LEN = 512
+)
+
+// LaunchRejectReason says why strict parsing rejected a launch query.
+type LaunchRejectReason string
+
+const (
+	ReasonMalformedQuery LaunchRejectReason = "malformed query string"
+	ReasonEmptyKey       LaunchRejectReason = "empty parameter name"
+	ReasonDuplicateKey   LaunchRejectReason = "parameter sent more than once"
+	ReasonNotNumeric     LaunchRejectReason = "parameter must be a positive integer"
+	ReasonValueTooLong   LaunchRejectReason = "parameter value too long"
+	ReasonTooManyParams  LaunchRejectReason = "too many parameters"
+)
+
+// numericLaunchParams - Launch parameters that must contain only digits
+var numericLaunchParams = []string{"app_id", "user_id", "ts"}
+
+// LaunchParamError is returned by ParseStrictLaunchQuery.
+type LaunchParamError struct {
+	// Reason - Why the query was rejected
+	Reason LaunchRejectReason
+
+	// Param - Name of the offending parameter (empty if the whole query is at fault)
+	Param string
+}
+
+// Error implements the error interface.
+func (e *LaunchParamError) Error() string {
+	if e.Param == "" {
+		return "invalid launch parameters: " + string(e.Reason)
+	}
+	return fmt.Sprintf("invalid launch parameter %q: %s", e.Param, e.Reason)
+}
+
+// ParseStrictLaunchQuery parses a raw query string and applies the strict rules above.
+// On success the returned values hold exactly one value per key.
+func ParseStrictLaunchQuery(rawQuery string) (url.Values, error) {
+	// url.ParseQuery drops malformed pairs but reports them as error
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, &LaunchParamError{Reason: ReasonMalformedQuery}
+	}
+
+	if len(values) > MAX_LAUNCH_PARAMS {
+		return nil, &LaunchParamError{Reason: ReasonTooManyParams}
+	}
+
+	for key, vals := range values {
+		if key == "" {
+			return nil, &LaunchParamError{Reason: ReasonEmptyKey}
+		}
+		if len(vals) > 1 {
+			return nil, &LaunchParamError{Reason: ReasonDuplicateKey, Param: key}
+		}
+		if len(vals[0]) > MAX_LAUNCH_PARAM_LEN {
+			return nil, &LaunchParamError{Reason: ReasonValueTooLong, Param: key}
+		}
+	}
+
+	for _, key := range numericLaunchParams {
+		if _, ok := values[key]; ok && !isDigits(values.Get(key)) {
+			return nil, &LaunchParamError{Reason: ReasonNotNumeric, Param: key}
+		}
+	}
+
+	return values, nil
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits that fits into int64.
+func isDigits(s string) bool {
+	if s == "" || len(s) > 18 {
+		return false
+	}
+	return strings.Trim(s, "0123456789") == ""
+}
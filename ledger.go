@@ -0,0 +1,371 @@
+package main
+
+// ====================================================================================
+// PURCHASE LEDGER
+// ====================================================================================
+// Ton.Place only knows the amount and title of a purchase. The ledger keeps the app's
+// side of every purchase created through /api/create-purchase: which SKU was bought,
+// in which session, the app-level order ID and the last known status.
+//
+// Records are kept in a PurchaseStore. MemoryPurchaseStore keeps them in process
+// memory; FilePurchaseStore additionally writes them to a JSON file so they survive
+// restarts. Implement PurchaseStore on top of a database when running several
+// server instances.
+// ====================================================================================
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// PURCHASE_LEDGER_FILE - Where FilePurchaseStore keeps purchase records
+const PURCHASE_LEDGER_FILE = "purchases.json"
+
+// ErrPurchaseNotFound - No record exists for the purchase
+var ErrPurchaseNotFound = errors.New("purchase not found")
+
+// ErrPurchaseExists - A record for the purchase ID already exists
+var ErrPurchaseExists = errors.New("purchase already recorded")
+
+// purchaseLedger records purchases created by handleCreatePurchase.
+// main replaces it with a FilePurchaseStore.
+var purchaseLedger PurchaseStore = NewMemoryPurchaseStore()
+
+// PurchaseRecord is the app's record of one purchase.
+type PurchaseRecord struct {
+	// PurchaseID - ID returned by Ton.Place (unique per app)
+	PurchaseID int64 `json:"purchase_id"`
+
+	// AppID - App the purchase was created for
+	AppID string `json:"app_id"`
+
+	// OrderID - App-level order ID, generated when the purchase is created
+	OrderID string `json:"order_id"`
+
+	// UserID - Ton.Place user who is buying
+	UserID int64 `json:"user_id"`
+
+	// SessionID - Session the purchase was created in
+	SessionID string `json:"session_id"`
+
+	// SKU - Catalog product that was requested
+	SKU string `json:"sku"`
+
+	// Title, Amount, Currency - Values sent to Ton.Place, resolved from the catalog
+	Title    string `json:"title"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+
+	// Status - Last known status: tonplace.StatusPending or tonplace.StatusPaid
+	Status string `json:"status"`
+
+	// CreatedAt - Unix timestamp when the purchase was created
+	CreatedAt int64 `json:"created_at"`
+
+	// UpdatedAt - Unix timestamp of the last status change
+	UpdatedAt int64 `json:"updated_at"`
+
+	// PaidAt - Unix timestamp when the purchase was first seen as paid (0 if not paid)
+	PaidAt int64 `json:"paid_at,omitempty"`
+}
+
+// PurchaseStore keeps purchase records.
+// Implementations must be safe for concurrent use.
+type PurchaseStore interface {
+	// Add records a new purchase. It returns ErrPurchaseExists if the app
+	// already has a record with the same purchase ID.
+	Add(rec PurchaseRecord) error
+
+	// Get returns the record of a purchase or ErrPurchaseNotFound.
+	Get(appID string, purchaseID int64) (PurchaseRecord, error)
+
+	// ByUser returns the user's purchases in an app, oldest first.
+	ByUser(appID string, userID int64) ([]PurchaseRecord, error)
+
+	// ByStatus returns purchases of all apps with the given status, oldest first.
+	ByStatus(status string) ([]PurchaseRecord, error)
+
+	// UpdateStatus sets the status of a purchase and returns the updated record.
+	// changed is false if the purchase already had that status; the record is then
+	// left unchanged. Of concurrent calls setting the same status, exactly one
+	// reports changed == true. StatusPaid is final: a paid purchase is never moved
+	// to another status, and such calls report changed == false.
+	UpdateStatus(appID string, purchaseID int64, status string, at time.Time) (rec PurchaseRecord, changed bool, err error)
+}
+
+// newOrderID generates a random app-level order ID.
+func newOrderID() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return "ord_" + hex.EncodeToString(id), nil
+}
+
+// ====================================================================================
+// IN-MEMORY PURCHASE STORE
+// ====================================================================================
+
+// purchaseKey identifies a purchase across apps.
+type purchaseKey struct {
+	appID      string
+	purchaseID int64
+}
+
+// MemoryPurchaseStore is a PurchaseStore keeping records in process memory.
+type MemoryPurchaseStore struct {
+	mu      sync.RWMutex
+	records map[purchaseKey]PurchaseRecord
+}
+
+// NewMemoryPurchaseStore creates an empty in-memory purchase store.
+func NewMemoryPurchaseStore() *MemoryPurchaseStore {
+	return &MemoryPurchaseStore{records: make(map[purchaseKey]PurchaseRecord)}
+}
+
+// Add implements PurchaseStore.
+func (s *MemoryPurchaseStore) Add(rec PurchaseRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(rec)
+}
+
+func (s *MemoryPurchaseStore) add(rec PurchaseRecord) error {
+	key := purchaseKey{rec.AppID, rec.PurchaseID}
+	if _, ok := s.records[key]; ok {
+		return fmt.Errorf("%w: app %s, purchase %d", ErrPurchaseExists, rec.AppID, rec.PurchaseID)
+	}
+	s.records[key] = rec
+	return nil
+}
+
+// Get implements PurchaseStore.
+func (s *MemoryPurchaseStore) Get(appID string, purchaseID int64) (PurchaseRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[purchaseKey{appID, purchaseID}]
+	if !ok {
+		return PurchaseRecord{}, ErrPurchaseNotFound
+	}
+	return rec, nil
+}
+
+// ByUser implements PurchaseStore.
+func (s *MemoryPurchaseStore) ByUser(appID string, userID int64) ([]PurchaseRecord, error) {
+	return s.filter(func(rec PurchaseRecord) bool {
+		return rec.AppID == appID && rec.UserID == userID
+	}), nil
+}
+
+// ByStatus implements PurchaseStore.
+func (s *MemoryPurchaseStore) ByStatus(status string) ([]PurchaseRecord, error) {
+	return s.filter(func(rec PurchaseRecord) bool {
+		return rec.Status == status
+	}), nil
+}
+
+// UpdateStatus implements PurchaseStore.
+func (s *MemoryPurchaseStore) UpdateStatus(appID string, purchaseID int64, status string, at time.Time) (PurchaseRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateStatus(appID, purchaseID, status, at)
+}
+
+// updateStatus changes the record and reports whether anything changed.
+func (s *MemoryPurchaseStore) updateStatus(appID string, purchaseID int64, status string, at time.Time) (PurchaseRecord, bool, error) {
+	key := purchaseKey{appID, purchaseID}
+	rec, ok := s.records[key]
+	if !ok {
+		return PurchaseRecord{}, false, ErrPurchaseNotFound
+	}
+	if rec.Status == status || rec.Status == tonplace.StatusPaid {
+		return rec, false, nil // Unchanged, or paid - which is final
+	}
+	rec.Status = status
+	rec.UpdatedAt = at.Unix()
+	if status == tonplace.StatusPaid && rec.PaidAt == 0 {
+		rec.PaidAt = at.Unix()
+	}
+	s.records[key] = rec
+	return rec, true, nil
+}
+
+// filter returns matching records sorted by creation time, then purchase ID.
+func (s *MemoryPurchaseStore) filter(match func(PurchaseRecord) bool) []PurchaseRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []PurchaseRecord{}
+	for _, rec := range s.records {
+		if match(rec) {
+			out = append(out, rec)
+		}
+	}
+	sortRecords(out)
+	return out
+}
+
+// sortRecords orders records by creation time, then app and purchase ID.
+func sortRecords(records []PurchaseRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		if a.AppID != b.AppID {
+			return a.AppID < b.AppID
+		}
+		return a.PurchaseID < b.PurchaseID
+	})
+}
+
+// ====================================================================================
+// FILE-BACKED PURCHASE STORE
+// ====================================================================================
+
+// FilePurchaseStore is a PurchaseStore that keeps records in memory and writes
+// all of them to a JSON file after every change. The file is replaced atomically,
+// so a crash never leaves a half-written ledger behind.
+//
+// The whole file is rewritten on each change, which is fine for a demo-sized ledger.
+// Only one process may use a file at a time.
+type FilePurchaseStore struct {
+	mem  *MemoryPurchaseStore
+	path string
+}
+
+// ledgerFile is the on-disk format of FilePurchaseStore.
+type ledgerFile struct {
+	Purchases []PurchaseRecord `json:"purchases"`
+}
+
+// OpenFilePurchaseStore loads the ledger at path. A missing file is treated
+// as an empty ledger and created on the first change.
+func OpenFilePurchaseStore(path string) (*FilePurchaseStore, error) {
+	s := &FilePurchaseStore{mem: NewMemoryPurchaseStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read purchase ledger: %w", err)
+	}
+
+	var file ledgerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse purchase ledger %s: %w", path, err)
+	}
+	for _, rec := range file.Purchases {
+		if err := s.mem.add(rec); err != nil {
+			return nil, fmt.Errorf("purchase ledger %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Add implements PurchaseStore.
+func (s *FilePurchaseStore) Add(rec PurchaseRecord) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if err := s.mem.add(rec); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		// Keep memory and file in sync
+		delete(s.mem.records, purchaseKey{rec.AppID, rec.PurchaseID})
+		return err
+	}
+	return nil
+}
+
+// Get implements PurchaseStore.
+func (s *FilePurchaseStore) Get(appID string, purchaseID int64) (PurchaseRecord, error) {
+	return s.mem.Get(appID, purchaseID)
+}
+
+// ByUser implements PurchaseStore.
+func (s *FilePurchaseStore) ByUser(appID string, userID int64) ([]PurchaseRecord, error) {
+	return s.mem.ByUser(appID, userID)
+}
+
+// ByStatus implements PurchaseStore.
+func (s *FilePurchaseStore) ByStatus(status string) ([]PurchaseRecord, error) {
+	return s.mem.ByStatus(status)
+}
+
+// UpdateStatus implements PurchaseStore.
+func (s *FilePurchaseStore) UpdateStatus(appID string, purchaseID int64, status string, at time.Time) (PurchaseRecord, bool, error) {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	old := s.mem.records[purchaseKey{appID, purchaseID}]
+	rec, changed, err := s.mem.updateStatus(appID, purchaseID, status, at)
+	if err != nil || !changed {
+		return rec, false, err
+	}
+	if err := s.save(); err != nil {
+		s.mem.records[purchaseKey{appID, purchaseID}] = old
+		return PurchaseRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+// save writes all records to a temporary file and renames it over the ledger.
+// The caller must hold s.mem.mu.
+func (s *FilePurchaseStore) save() error {
+	file := ledgerFile{Purchases: make([]PurchaseRecord, 0, len(s.mem.records))}
+	for _, rec := range s.mem.records {
+		file.Purchases = append(file.Purchases, rec)
+	}
+	sortRecords(file.Purchases)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write purchase ledger: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// String describes the store for log messages.
+func (s *FilePurchaseStore) String() string {
+	s.mem.mu.RLock()
+	defer s.mem.mu.RUnlock()
+	return s.path + " (" + strconv.Itoa(len(s.mem.records)) + " purchases)"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// ledgerRecord returns a pending record of app 1.
+func ledgerRecord(purchaseID, userID, createdAt int64) PurchaseRecord {
+	return PurchaseRecord{
+		PurchaseID: purchaseID,
+		AppID:      "1",
+		OrderID:    "ord_test",
+		UserID:     userID,
+		SKU:        "coins_100",
+		Amount:     200,
+		Currency:   "eur",
+		Status:     tonplace.StatusPending,
+		CreatedAt:  createdAt,
+		UpdatedAt:  createdAt,
+	}
+}
+
+// purchaseIDs returns the purchase IDs of records in order.
+func purchaseIDs(records []PurchaseRecord) []int64 {
+	ids := make([]int64, len(records))
+	for i, rec := range records {
+		ids[i] = rec.PurchaseID
+	}
+	return ids
+}
+
+func TestFilePurchaseStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "purchases.json")
+	store, err := OpenFilePurchaseStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Added out of order; another user and another app in between
+	for _, rec := range []PurchaseRecord{
+		ledgerRecord(3, 5, 300),
+		ledgerRecord(1, 5, 100),
+		ledgerRecord(2, 6, 200),
+		ledgerRecord(4, 5, 100),
+		{PurchaseID: 1, AppID: "2", UserID: 5, Status: tonplace.StatusPending, CreatedAt: 50},
+	} {
+		if err := store.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Add(ledgerRecord(1, 5, 100)); !errors.Is(err, ErrPurchaseExists) {
+		t.Errorf("duplicate Add: err = %v, want %v", err, ErrPurchaseExists)
+	}
+	paid, changed, err := store.UpdateStatus("1", 4, tonplace.StatusPaid, time.Unix(400, 0))
+	if err != nil || !changed {
+		t.Fatalf("UpdateStatus = %v, %v", changed, err)
+	}
+
+	reopened, err := OpenFilePurchaseStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Get("1", 4); err != nil || got != paid {
+		t.Errorf("Get after reopen = %+v, %v; want %+v", got, err, paid)
+	}
+
+	tests := []struct {
+		name string
+		list func(PurchaseStore) ([]PurchaseRecord, error)
+		want []int64
+	}{
+		{"ByUser", func(s PurchaseStore) ([]PurchaseRecord, error) { return s.ByUser("1", 5) }, []int64{1, 4, 3}},
+		{"ByUser other app", func(s PurchaseStore) ([]PurchaseRecord, error) { return s.ByUser("2", 5) }, []int64{1}},
+		{"ByUser unknown user", func(s PurchaseStore) ([]PurchaseRecord, error) { return s.ByUser("1", 7) }, []int64{}},
+		{"ByStatus pending", func(s PurchaseStore) ([]PurchaseRecord, error) { return s.ByStatus(tonplace.StatusPending) }, []int64{1, 1, 2, 3}},
+		{"ByStatus paid", func(s PurchaseStore) ([]PurchaseRecord, error) { return s.ByStatus(tonplace.StatusPaid) }, []int64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Same result before and after reopening
+			for _, s := range []PurchaseStore{store, reopened} {
+				records, err := tt.list(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := purchaseIDs(records); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%v: got %v, want %v", s, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilePurchaseStoreRollsBackFailedWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ledger")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenFilePurchaseStore(filepath.Join(dir, "purchases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := ledgerRecord(1, 5, 100)
+	if err := store.Add(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without its directory the ledger can't be written
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Add(ledgerRecord(2, 5, 200)); err == nil {
+		t.Fatal("Add succeeded without a writable ledger")
+	}
+	if _, err := store.Get("1", 2); !errors.Is(err, ErrPurchaseNotFound) {
+		t.Errorf("failed Add kept the record: err = %v", err)
+	}
+
+	if _, changed, err := store.UpdateStatus("1", 1, tonplace.StatusPaid, time.Unix(300, 0)); err == nil || changed {
+		t.Fatalf("UpdateStatus = %v, %v; want an error", changed, err)
+	}
+	if got, _ := store.Get("1", 1); got != pending {
+		t.Errorf("failed UpdateStatus changed the record to %+v", got)
+	}
+}
+
+func TestOpenFilePurchaseStore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"missing file is empty", filepath.Join(dir, "missing.json"), false},
+		{"corrupt file", write("corrupt.json", "{"), true},
+		{"duplicate purchase", write("duplicate.json", `{"purchases": [{"purchase_id": 1, "app_id": "1"}, {"purchase_id": 1, "app_id": "1"}]}`), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := OpenFilePurchaseStore(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if records, _ := store.ByStatus(tonplace.StatusPending); len(records) != 0 {
+					t.Errorf("got %d records, want none", len(records))
+				}
+			}
+		})
+	}
+}
@@ -15,19 +15,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"tonplace_app_demo/tonplace"
 )
 
 // ====================================================================================
@@ -39,8 +44,9 @@ import (
 
 const (
 	// APP_ID - Your application ID from Ton.Place (required)
-	// This is a numeric identifier assigned to your app when you create it
-	APP_ID = "YOUR_APP_ID"
+	// This is a numeric identifier assigned to your app when you create it.
+	// The placeholder is numeric too, so strict launch parsing accepts local test URLs
+	APP_ID = "12345"
 
 	// APP_SECRET - Your application secret key from Ton.Place (required, keep it private!)
 	// This 32-character string is used to sign and verify requests
@@ -57,6 +63,13 @@ const (
 	// SIGNATURE_MAX_AGE - Maximum age of signature in seconds (5 minutes)
 	// Requests with older timestamps will be rejected to prevent replay attacks
 	SIGNATURE_MAX_AGE = 300
+
+	// API_RATE_LIMIT - Maximum average number of Ton.Place API requests per second
+	// Shared by all handlers; requests above the limit wait for a free slot
+	API_RATE_LIMIT = 10
+
+	// API_RATE_BURST - Number of API requests that may be sent at once before limiting kicks in
+	API_RATE_BURST = 20
 )
 
 // ====================================================================================
@@ -92,76 +105,24 @@ type UserParams struct {
 	Hash string `json:"hash"`
 }
 
-// Transaction represents a purchase record from Ton.Place API.
-// This is returned by GET /apps/purchases endpoint.
-type Transaction struct {
-	// ID - Unique identifier of the transaction
-	ID int64 `json:"id"`
-
-	// Amount - Purchase amount in smallest currency unit (cents for EUR, nanotons for TON)
-	// For EUR: 1 EUR = 100 (smallest unit)
-	// For TON: 1 TON = 1,000,000,000 (smallest unit)
-	Amount int64 `json:"amount"`
-
-	// Currency - Currency code: "eur" or "ton"
-	// Currently only "eur" is supported for purchases
-	Currency string `json:"currency"`
-
-	// UserID - ID of the user who made the purchase
-	UserID int64 `json:"user_id"`
-
-	// CreatedAt - Unix timestamp when purchase was created
-	CreatedAt int64 `json:"created_at"`
-
-	// Status - Purchase status: "pending" or "paid"
-	// "pending" - payment initiated but not completed
-	// "paid" - payment successfully completed
-	Status string `json:"status"`
-
-	// Title - Purchase description/title (set when creating purchase)
-	Title string `json:"title"`
-}
-
-// TransactionsResponse represents the API response for GET /apps/purchases
-type TransactionsResponse struct {
-	Transactions []Transaction `json:"transactions"`
-}
-
-// CreatePurchaseRequest represents the request body for creating a new purchase.
-// This is sent to POST /apps/purchase/create endpoint.
-type CreatePurchaseRequest struct {
-	// Amount - Purchase amount in smallest currency unit (required)
-	// For EUR: value in cents (e.g., 100 = 1.00 EUR)
-	// Must be greater than 0
-	Amount int64 `json:"amount"`
-
-	// Currency - Currency code (required)
-	// Currently only "eur" is supported
-	Currency string `json:"currency"`
-
-	// Title - Short description of what user is paying for (required)
-	// Maximum 150 characters
-	// Shown to user in payment dialog
-	Title string `json:"title"`
-
-	// UserID - ID of the user who should pay (required)
-	// Must match a valid Ton.Place user ID
-	UserID int64 `json:"user_id"`
-}
-
-// CreatePurchaseResponse represents the API response for POST /apps/purchase/create
-type CreatePurchaseResponse struct {
-	// PurchaseID - Unique identifier of the created purchase
-	// Use this ID with TonPlace.purchase() SDK method to initiate payment
-	PurchaseID int64 `json:"purchase_id"`
-}
-
 // PageData contains all data passed to the HTML template
 type PageData struct {
 	User         UserParams
-	Transactions []Transaction
+	Transactions []tonplace.Transaction
 	Error        string
 	IsAuthorized bool
+	FromSession  bool // Authenticated by session cookie instead of launch signature
+
+	// AccessToken - Short-lived bearer token for the page's API calls
+	AccessToken string
+	// AccessTokenExpiresAt - Unix timestamp when AccessToken expires
+	AccessTokenExpiresAt int64
+
+	// Products - Catalog products the user can buy
+	Products []Product
+
+	// Entitlements - What the user owns
+	Entitlements []EntitlementStatus
 }
 
 // ====================================================================================
@@ -188,7 +149,24 @@ type PageData struct {
 // Returns true if signature is valid, false otherwise.
 func VerifySignatureFromQuery(queryParams map[string][]string, secret string) bool {
 	// Step 1: Collect all parameters except "hash" into a map
-	// Take the first value for each parameter (standard behavior for query strings)
+	paramsMap := launchParams(queryParams)
+
+	// Steps 2-5: Compute the signature we expect for these parameters
+	expectedHash := SignParams(paramsMap, secret)
+
+	// Step 6: Get the provided hash from query params
+	providedHash := ""
+	if hashValues, ok := queryParams["hash"]; ok && len(hashValues) > 0 {
+		providedHash = hashValues[0]
+	}
+
+	// Step 7: Compare hashes using constant-time comparison to prevent timing attacks
+	return hmac.Equal([]byte(expectedHash), []byte(providedHash))
+}
+
+// launchParams collects all launch parameters except "hash" into a map.
+// Takes the first value for each parameter (standard behavior for query strings).
+func launchParams(queryParams map[string][]string) map[string]string {
 	paramsMap := make(map[string]string)
 	for key, values := range queryParams {
 		if key == "hash" {
@@ -198,11 +176,22 @@ func VerifySignatureFromQuery(queryParams map[string][]string, secret string) bo
 			paramsMap[key] = values[0]
 		}
 	}
+	return paramsMap
+}
 
+// SignParams computes the launch signature ("hash" parameter) for the given parameters.
+// It is the counterpart of VerifySignatureFromQuery and uses the same scheme, so it can
+// be used to build valid launch URLs for local testing (see the sign-url command).
+// A "hash" key in params is ignored.
+// Returns the signature as lowercase hex string.
+func SignParams(params map[string]string, secret string) string {
 	// Step 2: Get sorted list of keys
 	// IMPORTANT: Keys must be sorted alphabetically for consistent signature
-	keys := make([]string, 0, len(paramsMap))
-	for key := range paramsMap {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key == "hash" {
+			continue
+		}
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
@@ -215,7 +204,7 @@ func VerifySignatureFromQuery(queryParams map[string][]string, secret string) bo
 		if i > 0 {
 			checkStr += "\n"
 		}
-		checkStr += key + "=" + paramsMap[key]
+		checkStr += key + "=" + params[key]
 	}
 
 	// Debug: uncomment to see what string is being signed
@@ -230,172 +219,115 @@ func VerifySignatureFromQuery(queryParams map[string][]string, secret string) bo
 	// Step 5: Create HMAC-SHA256 of the check string using hashed secret
 	h := hmac.New(sha256.New, secretKey)
 	h.Write([]byte(checkStr))
-	expectedHash := hex.EncodeToString(h.Sum(nil))
-
-	// Step 6: Get the provided hash from query params
-	providedHash := ""
-	if hashValues, ok := queryParams["hash"]; ok && len(hashValues) > 0 {
-		providedHash = hashValues[0]
-	}
-
-	// Step 7: Compare hashes using constant-time comparison to prevent timing attacks
-	return hmac.Equal([]byte(expectedHash), []byte(providedHash))
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // ValidateTimestamp checks if the signature timestamp is not too old.
 // This prevents replay attacks where an attacker captures a valid request and resends it later.
+// It applies the default policy of NewVerifier; use a Verifier for other limits or a fake clock.
 func ValidateTimestamp(tsStr string) bool {
-	ts, err := strconv.ParseInt(tsStr, 10, 64)
-	if err != nil {
-		return false
-	}
-
-	now := time.Now().Unix()
-	age := now - ts
-
-	// Reject if timestamp is in the future (clock skew tolerance: 60 seconds)
-	if age < -60 {
-		return false
-	}
-
-	// Reject if timestamp is too old
-	if age > SIGNATURE_MAX_AGE {
-		return false
-	}
-
-	return true
+	return NewVerifier(nil).CheckTimestamp(tsStr) == nil
 }
 
 // ====================================================================================
-// TON.PLACE API CLIENT FUNCTIONS
+// TON.PLACE API CLIENT
+// ====================================================================================
+// All calls to the Ton.Place Public API go through the tonplace package.
+// See tonplace/purchases.go for the list of supported endpoints.
+// Each app has its own client, see AppConfig in apps.go.
 // ====================================================================================
 
-// GetTransactions fetches the list of transactions (purchases) for your app.
-//
-// API Endpoint: GET /apps/purchases
-//
-// Headers (required):
-//   - App-Id: Your application ID
-//   - Secret: Your application secret
-//
-// Query Parameters (all optional):
-//   - count: Number of transactions to return (default: 20, max: 100)
-//   - last_id: Last transaction ID for pagination (default: 0)
-//   - status: Filter by status - "pending" or "paid" (optional, returns all if not specified)
-//   - userId: Filter by user ID (optional)
-//
-// Returns: List of transactions or error
-func GetTransactions(appID, secret string, userID int64) ([]Transaction, error) {
-	// Build URL with query parameters
-	url := fmt.Sprintf("%s/apps/purchases?count=50&userId=%d", TON_PLACE_API, userID)
-
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// fetchTransactions loads the complete purchase history of a user,
+// following the API's pagination cursor until all pages are read.
+// Statuses of purchases in the ledger are updated along the way.
+func fetchTransactions(ctx context.Context, client *tonplace.Client, userID int64) ([]tonplace.Transaction, error) {
+	transactions := []tonplace.Transaction{}
+	for tx, err := range client.AllPurchases(ctx, tonplace.ListPurchasesOptions{UserID: userID}, 0) {
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
 	}
+	purchaseReconciler.Observe(ctx, client.AppID(), transactions)
+	return transactions, nil
+}
 
-	// Set required authentication headers
-	// These headers authenticate your app with Ton.Place API
-	req.Header.Set("App-Id", appID)  // Your app ID
-	req.Header.Set("Secret", secret) // Your app secret (keep it private!)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+// countPaidPurchases counts the user's paid purchases of a product in the ledger.
+// Statuses are refreshed from Ton.Place first, so a payment completed a moment ago
+// counts. Pending purchases don't: a user who cancelled the payment dialog may buy again.
+func countPaidPurchases(ctx context.Context, app *AppConfig, userID int64, product Product) (int, error) {
+	if _, err := fetchTransactions(ctx, app.Client, userID); err != nil {
+		return 0, err
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	records, err := purchaseLedger.ByUser(app.ID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return 0, err
 	}
-
-	// Parse JSON response
-	var result TransactionsResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	count := 0
+	for _, rec := range records {
+		if rec.SKU == product.SKU && rec.Status == tonplace.StatusPaid {
+			count++
+		}
 	}
-
-	return result.Transactions, nil
+	return count, nil
 }
 
-// CreatePurchase creates a new purchase request that user can pay for.
-//
-// API Endpoint: POST /apps/purchase/create
-//
-// Headers (required):
-//   - App-Id: Your application ID
-//   - Secret: Your application secret
-//
-// Request Body:
-//   - amount: Amount in smallest unit (cents for EUR) - required, must be > 0
-//   - currency: Currency code - required, must be "eur"
-//   - title: Purchase description - required, max 150 characters
-//   - user_id: User ID who will pay - required
-//
-// Returns: Purchase ID that you pass to TonPlace.purchase() SDK method
-func CreatePurchase(appID, secret string, userID int64, amount int64, title string) (int64, error) {
-	// Prepare request body
-	reqBody := CreatePurchaseRequest{
-		Amount:   amount,
-		Currency: "eur", // Currently only "eur" is supported
-		Title:    title,
-		UserID:   userID,
-	}
-
-	// Serialize to JSON
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return 0, fmt.Errorf("failed to marshal request: %w", err)
+// errPurchaseLimitReached - The user already paid for MaxPerUser purchases of the product
+var errPurchaseLimitReached = errors.New("purchase limit reached")
+
+// createPurchase checks the product's per-user limit, creates the purchase on
+// Ton.Place and records it in the ledger. Errors are logged here.
+func createPurchase(ctx context.Context, auth *Auth, product Product) (int64, error) {
+	// Enforce per-user limits
+	if product.MaxPerUser > 0 {
+		count, err := countPaidPurchases(ctx, auth.App, auth.UserID, product)
+		if err != nil {
+			log.Printf("Failed to check purchase limit: %v", err)
+			return 0, err
+		}
+		if count >= product.MaxPerUser {
+			return 0, errPurchaseLimitReached
+		}
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", TON_PLACE_API+"/apps/purchase/create", bytes.NewBuffer(jsonBody))
+	orderID, err := newOrderID()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		log.Printf("Failed to generate order ID: %v", err)
+		return 0, err
 	}
 
-	// Set required headers
-	req.Header.Set("App-Id", appID)
-	req.Header.Set("Secret", secret)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	// Create purchase via Ton.Place API
+	purchaseID, err := auth.App.Client.CreatePurchase(ctx, auth.UserID, product.Amount, product.Title)
 	if err != nil {
-		return 0, fmt.Errorf("request failed: %w", err)
+		log.Printf("Failed to create purchase: %v", err)
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	// Record the purchase in the ledger
+	// Without a record the app couldn't tell which product was bought, so the
+	// client doesn't get the purchase ID; the unpaid purchase simply stays pending.
+	now := time.Now().Unix()
+	err = purchaseLedger.Add(PurchaseRecord{
+		PurchaseID: purchaseID,
+		AppID:      auth.App.ID,
+		OrderID:    orderID,
+		UserID:     auth.UserID,
+		SessionID:  auth.Session.ID,
+		SKU:        product.SKU,
+		Title:      product.Title,
+		Amount:     product.Amount,
+		Currency:   product.Currency,
+		Status:     tonplace.StatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+		log.Printf("Failed to record purchase %d (order %s): %v", purchaseID, orderID, err)
+		return 0, err
 	}
+	log.Printf("Created purchase %d (order %s, sku %s) for user %d", purchaseID, orderID, product.SKU, auth.UserID)
 
-	// Check for errors
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var result CreatePurchaseResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return result.PurchaseID, nil
+	return purchaseID, nil
 }
 
 // ====================================================================================
@@ -403,71 +335,50 @@ func CreatePurchase(appID, secret string, userID int64, amount int64, title stri
 // ====================================================================================
 
 // handleIndex is the main page handler.
-// It verifies user authorization and displays their data and transaction history.
+// It displays the verified user's data and transaction history.
 func handleIndex(w http.ResponseWriter, r *http.Request) {
-	// Skip favicon requests
-	if r.URL.Path == "/favicon.ico" {
-		http.NotFound(w, r)
-		return
-	}
-
-	// Get all query parameters from the request
-	// Ton.Place appends these to your app URL when user opens the app
-	queryParams := r.URL.Query()
-
-	// Extract known parameters for display (these are the common ones)
-	// But signature verification uses ALL parameters dynamically
-	params := UserParams{
-		AppID:     queryParams.Get("app_id"),
-		UserID:    queryParams.Get("user_id"),
-		Timestamp: queryParams.Get("ts"),
-		FirstName: queryParams.Get("first_name"), // May be empty if not sent
-		LastName:  queryParams.Get("last_name"),  // May be empty if not sent
-		Hash:      queryParams.Get("hash"),
-	}
+	// The user was verified by RequireTonPlaceUser
+	auth, _ := AuthFromContext(r.Context())
+	app, userID := auth.App, auth.UserID
 
 	// Prepare page data
 	data := PageData{
-		User:         params,
-		IsAuthorized: false,
+		User:         auth.User,
+		IsAuthorized: true,
+		FromSession:  auth.FromSession,
+		Products:     productCatalog.Products(),
 	}
 
-	// Check if required parameters are present
-	if params.Hash == "" || params.UserID == "" {
-		data.Error = "Missing required parameters. This app must be opened from Ton.Place."
-		renderPage(w, data)
-		return
-	}
-
-	// Validate timestamp to prevent replay attacks
-	if !ValidateTimestamp(params.Timestamp) {
-		data.Error = "Request expired or invalid timestamp. Please refresh the page."
-		renderPage(w, data)
-		return
-	}
-
-	// Verify signature using ALL query parameters (not just the hardcoded ones)
-	// This is important because Ton.Place may send different sets of parameters
-	if !VerifySignatureFromQuery(queryParams, APP_SECRET) {
-		data.Error = "Invalid signature. Request may have been tampered with."
-		renderPage(w, data)
-		return
+	// Give the page's JavaScript a token for API calls
+	// (cookies may be blocked inside the Ton.Place iframe)
+	token, expiresAt, err := issueAccessToken(auth.Session)
+	if err != nil {
+		log.Printf("Failed to issue access token: %v", err)
+		data.Error = "Failed to start session. Please reopen the app from Ton.Place."
 	}
-
-	// Authorization successful!
-	data.IsAuthorized = true
+	data.AccessToken = token
+	data.AccessTokenExpiresAt = expiresAt.Unix()
 
 	// Fetch user's transaction history
-	userID, _ := strconv.ParseInt(params.UserID, 10, 64)
-	transactions, err := GetTransactions(APP_ID, APP_SECRET, userID)
+	transactions, err := fetchTransactions(r.Context(), app.Client, userID)
 	if err != nil {
 		log.Printf("Failed to fetch transactions: %v", err)
 		// Don't fail the page, just show empty transactions
-		data.Transactions = []Transaction{}
+		data.Transactions = []tonplace.Transaction{}
+		if app.Client.BreakerState() != tonplace.BreakerClosed {
+			data.Error = "Transaction history is unavailable: " + apiErrorMessage(err)
+		}
 	} else {
 		data.Transactions = transactions
 	}
 
+	// Load what the user owns (after fetching transactions, which may have granted more)
+	if list, err := EntitlementsFor(app.ID).List(userID); err != nil {
+		log.Printf("Failed to load entitlements of user %d: %v", userID, err)
+	} else {
+		data.Entitlements = entitlementStatuses(list, time.Now())
+	}
+
 	renderPage(w, data)
 }
 
@@ -483,11 +394,15 @@ func handleCreatePurchase(w http.ResponseWriter, r *http.Request) {
 	// Set JSON response header
 	w.Header().Set("Content-Type", "application/json")
 
+	// The user was verified by RequireAccessToken
+	// The purchase is always created for that user, never for a client-supplied ID
+	auth, _ := AuthFromContext(r.Context())
+
 	// Parse request body
+	// Only the SKU is taken from the client - price and title come from the catalog
 	var req struct {
-		UserID int64  `json:"user_id"`
-		Amount int64  `json:"amount"` // Amount in cents
-		Title  string `json:"title"`
+		UserID int64  `json:"user_id"` // Optional; must match the authenticated user if sent
+		SKU    string `json:"sku"`     // Product to buy, see catalog.json
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -496,27 +411,62 @@ func handleCreatePurchase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate input
-	if req.Amount <= 0 {
-		json.NewEncoder(w).Encode(map[string]string{"error": "Amount must be greater than 0"})
+	// Reject attempts to create purchases for other users
+	if req.UserID != 0 && req.UserID != auth.UserID {
+		writeForbidden(w, auth.UserID, req.UserID)
 		return
 	}
-	if req.Title == "" {
-		json.NewEncoder(w).Encode(map[string]string{"error": "Title is required"})
+
+	// Resolve the product
+	if req.SKU == "" {
+		json.NewEncoder(w).Encode(map[string]string{"error": "sku is required"})
 		return
 	}
-	if len(req.Title) > 150 {
-		json.NewEncoder(w).Encode(map[string]string{"error": "Title must be 150 characters or less"})
+	product, ok := productCatalog.Lookup(req.SKU)
+	if !ok {
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown product"})
 		return
 	}
 
-	// Create purchase via Ton.Place API
-	purchaseID, err := CreatePurchase(APP_ID, APP_SECRET, req.UserID, req.Amount, req.Title)
-	if err != nil {
-		log.Printf("Failed to create purchase: %v", err)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create purchase: " + err.Error()})
+	// Create the purchase - once per Idempotency-Key, if the client sent one
+	var purchaseID int64
+	var replayed bool
+	var err error
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if err := validIdempotencyKey(key); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		// Not cancelled with the request: if the client disconnects, the purchase may
+		// still be created at Ton.Place, and its retry must get that purchase
+		createCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), IDEMPOTENT_CREATE_TIMEOUT)
+		defer cancel()
+		purchaseID, replayed, err = purchaseIdempotency.Do(r.Context(),
+			idempotencyScope(auth.App.ID, auth.UserID, key),
+			idempotencyFingerprint(product.SKU),
+			func() (int64, error) { return createPurchase(createCtx, auth, product) })
+	} else {
+		purchaseID, err = createPurchase(r.Context(), auth, product)
+	}
+
+	switch {
+	case errors.Is(err, errIdempotencyKeyReused):
+		log.Printf("Rejected purchase: user %d reused an idempotency key for a different request", auth.UserID)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Idempotency-Key was already used for a different purchase"})
+		return
+	case errors.Is(err, errPurchaseLimitReached):
+		json.NewEncoder(w).Encode(map[string]string{"error": "You can't buy this product again"})
+		return
+	case err != nil:
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create purchase: " + apiErrorMessage(err)})
 		return
 	}
+	if replayed {
+		// Same purchase as the first request with this key
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 
 	// Return purchase ID - client will use this with TonPlace.purchase()
 	json.NewEncoder(w).Encode(map[string]int64{"purchase_id": purchaseID})
@@ -526,22 +476,58 @@ func handleCreatePurchase(w http.ResponseWriter, r *http.Request) {
 func handleGetTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	userIDStr := r.URL.Query().Get("user_id")
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
-	if err != nil {
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user_id"})
-		return
+	// The user was verified by RequireAccessToken
+	// Only the user's own transactions are returned
+	auth, _ := AuthFromContext(r.Context())
+
+	// user_id is optional; if sent, it must match the authenticated user
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		userID, err := strconv.ParseInt(userIDStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user_id"})
+			return
+		}
+		if userID != auth.UserID {
+			writeForbidden(w, auth.UserID, userID)
+			return
+		}
 	}
 
-	transactions, err := GetTransactions(APP_ID, APP_SECRET, userID)
+	transactions, err := fetchTransactions(r.Context(), auth.App.Client, auth.UserID)
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		log.Printf("Failed to fetch transactions: %v", err)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch transactions: " + apiErrorMessage(err)})
 		return
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{"transactions": transactions})
 }
 
+// writeForbidden answers an API request that targets another user than the authenticated one.
+func writeForbidden(w http.ResponseWriter, sessionUserID, requestedUserID int64) {
+	log.Printf("Rejected API request: user %d tried to act as user %d", sessionUserID, requestedUserID)
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": "user_id does not match the authenticated user"})
+}
+
+// apiErrorMessage converts a Ton.Place API error into a message that is safe to show
+// in the browser. Details (status, response body) are only written to the server log.
+func apiErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, tonplace.ErrUnauthorized):
+		return "app is not authorized with Ton.Place"
+	case errors.Is(err, tonplace.ErrRateLimited), errors.Is(err, tonplace.ErrRateLimitWait):
+		return "too many requests, please try again in a moment"
+	case errors.Is(err, tonplace.ErrInvalidRequest):
+		return "request was rejected by Ton.Place"
+	case errors.Is(err, tonplace.ErrUpstreamUnavailable):
+		return "Ton.Place is temporarily unavailable"
+	default:
+		return "unexpected error"
+	}
+}
+
 // renderPage renders the HTML template with given data
 func renderPage(w http.ResponseWriter, data PageData) {
 	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{
@@ -718,10 +704,17 @@ const htmlTemplate = `<!DOCTYPE html>
             <span class="label">Timestamp</span>
             <span class="value">{{.User.Timestamp}}</span>
         </div>
+        {{if .FromSession}}
+        <div class="info-row">
+            <span class="label">Session</span>
+            <span class="value" style="color: green;">✓ Restored</span>
+        </div>
+        {{else}}
         <div class="info-row">
             <span class="label">Signature Valid</span>
             <span class="value" style="color: green;">✓ Verified</span>
         </div>
+        {{end}}
     </div>
 
     <!-- ============================================================== -->
@@ -736,25 +729,62 @@ const htmlTemplate = `<!DOCTYPE html>
             <span class="comment">// 1. Create purchase on your backend</span><br>
             fetch('/api/create-purchase', {<br>
             &nbsp;&nbsp;method: 'POST',<br>
+            &nbsp;&nbsp;headers: {<br>
+            &nbsp;&nbsp;&nbsp;&nbsp;Authorization: 'Bearer ' + accessToken,<br>
+            &nbsp;&nbsp;&nbsp;&nbsp;'Idempotency-Key': key <span class="comment">// same key on retry = same purchase</span><br>
+            &nbsp;&nbsp;},<br>
             &nbsp;&nbsp;body: JSON.stringify({<br>
-            &nbsp;&nbsp;&nbsp;&nbsp;user_id: {{.User.UserID}},<br>
-            &nbsp;&nbsp;&nbsp;&nbsp;amount: 100, <span class="comment">// 1.00 EUR in cents</span><br>
-            &nbsp;&nbsp;&nbsp;&nbsp;title: "Premium Feature"<br>
+            &nbsp;&nbsp;&nbsp;&nbsp;sku: "premium_feature" <span class="comment">// price is set by the server</span><br>
             &nbsp;&nbsp;})<br>
             });<br><br>
             <span class="comment">// 2. Open payment dialog with SDK</span><br>
             TonPlace.purchase(purchaseId, onSuccess);
         </div>
 
-        <button class="btn" onclick="makePurchase()">
-            💰 Pay 1.00 EUR (Demo)
+        {{range .Products}}
+        <button class="btn" onclick="makePurchase('{{.SKU}}')">
+            💰 {{.Title}} - {{formatAmount .Amount .Currency}}
         </button>
+        {{else}}
+        <p style="color: #666; text-align: center; padding: 20px;">
+            No products configured. Add some to catalog.json.
+        </p>
+        {{end}}
 
         <p style="font-size: 12px; color: #666; margin-top: 8px;">
             This will create a real purchase request. You'll see the payment dialog.
         </p>
     </div>
 
+    <!-- ============================================================== -->
+    <!-- ENTITLEMENTS SECTION                                           -->
+    <!-- What the user owns after paid purchases                        -->
+    <!-- ============================================================== -->
+    <div class="card">
+        <h2>🎁 Your Entitlements</h2>
+        <p class="section-title">Granted once a purchase is paid:</p>
+
+        <div id="entitlements-list">
+        {{range .Entitlements}}
+            <div class="transaction">
+                <div class="transaction-header">
+                    <span class="transaction-title">{{.Key}}</span>
+                    <span class="status {{if .Active}}status-paid{{else}}status-pending{{end}}">
+                        {{if .Active}}active{{else}}inactive{{end}}
+                    </span>
+                </div>
+                <div class="transaction-meta">
+                    {{.Type}}{{if eq .Type "consumable"}} | {{.Quantity}} left{{end}}{{if eq .Type "timed"}} | until {{formatTime .ExpiresAt}}{{end}}
+                </div>
+            </div>
+        {{else}}
+            <p style="color: #666; text-align: center; padding: 20px;">
+                Nothing yet. Buy a product above!
+            </p>
+        {{end}}
+        </div>
+    </div>
+
     <!-- ============================================================== -->
     <!-- SDK METHODS DEMO                                               -->
     <!-- Shows other available SDK methods                              -->
@@ -894,6 +924,54 @@ const htmlTemplate = `<!DOCTYPE html>
         // Store user ID for API calls (convert to number, template returns string)
         var userId = parseInt('{{.User.UserID}}', 10) || 0;
 
+        // Short-lived access token for our backend API
+        // Sent as "Authorization: Bearer" header, because cookies may be blocked in the iframe
+        var accessToken = '{{.AccessToken}}';
+        var accessTokenExpiresAt = {{.AccessTokenExpiresAt}};
+
+        // Idempotency keys of purchase attempts in progress, by SKU
+        var purchaseKeys = {};
+
+        /**
+         * Returns headers for backend API calls, including the access token
+         */
+        function apiHeaders() {
+            return {
+                'Content-Type': 'application/json',
+                'Authorization': 'Bearer ' + accessToken
+            };
+        }
+
+        /**
+         * Exchanges the current access token for a new one before it expires
+         * Runs automatically one minute before expiry
+         */
+        function refreshAccessToken() {
+            fetch('/api/refresh-token', { method: 'POST', headers: apiHeaders() })
+            .then(function(response) { return response.json(); })
+            .then(function(data) {
+                if (data.error) {
+                    console.error('Token refresh failed:', data.error);
+                    return;
+                }
+                accessToken = data.access_token;
+                accessTokenExpiresAt = data.expires_at;
+                scheduleTokenRefresh();
+            })
+            .catch(function(error) {
+                console.error('Token refresh error:', error);
+            });
+        }
+
+        function scheduleTokenRefresh() {
+            if (!accessToken) {
+                return;
+            }
+            var delay = (accessTokenExpiresAt - 60) * 1000 - Date.now();
+            setTimeout(refreshAccessToken, Math.max(delay, 0));
+        }
+        scheduleTokenRefresh();
+
         /**
          * Creates a purchase and opens payment dialog
          *
@@ -903,22 +981,28 @@ const htmlTemplate = `<!DOCTYPE html>
          * 3. Wait for success/error callback
          * 4. Refresh transactions to see the result
          */
-        function makePurchase() {
+        function makePurchase(sku) {
+            // One idempotency key per purchase attempt: double-clicks and retries
+            // send the same key, so the server creates only one purchase
+            if (!purchaseKeys[sku]) {
+                purchaseKeys[sku] = newIdempotencyKey();
+            }
+            var headers = apiHeaders();
+            headers['Idempotency-Key'] = purchaseKeys[sku];
+
             // Step 1: Create purchase on backend
             fetch('/api/create-purchase', {
                 method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
+                headers: headers,
                 body: JSON.stringify({
-                    user_id: userId,
-                    amount: 100,  // 1.00 EUR in cents
-                    title: 'Demo Purchase'
+                    sku: sku  // The server resolves price and title from its catalog
                 })
             })
             .then(function(response) { return response.json(); })
             .then(function(data) {
                 if (data.error) {
+                    // The server released the key; the next click starts a new attempt
+                    delete purchaseKeys[sku];
                     alert('Error: ' + data.error);
                     return;
                 }
@@ -928,17 +1012,29 @@ const htmlTemplate = `<!DOCTYPE html>
                 TonPlace.purchase(
                     data.purchase_id,
                     function(result) {
-                        // Payment successful!
+                        // Payment successful! The next purchase of this SKU needs a new key
+                        delete purchaseKeys[sku];
                         alert('Payment successful!');
                         refreshTransactions();
                     }
                 );
             })
             .catch(function(error) {
+                // Keep the key: if the purchase was created, retrying returns the same one
                 alert('Network error: ' + error);
             });
         }
 
+        /**
+         * Generates a random Idempotency-Key
+         */
+        function newIdempotencyKey() {
+            if (window.crypto && crypto.randomUUID) {
+                return crypto.randomUUID();
+            }
+            return Date.now().toString(36) + '-' + Math.random().toString(36).slice(2);
+        }
+
         /**
          * Opens share dialog for the app
          * Users can share your app with friends
@@ -960,7 +1056,7 @@ const htmlTemplate = `<!DOCTYPE html>
          * Use this for polling after payment
          */
         function refreshTransactions() {
-            fetch('/api/transactions?user_id=' + userId)
+            fetch('/api/transactions?user_id=' + userId, { headers: apiHeaders() })
             .then(function(response) { return response.json(); })
             .then(function(data) {
                 if (data.error) {
@@ -996,6 +1092,53 @@ const htmlTemplate = `<!DOCTYPE html>
                     '</div>';
                 });
                 container.innerHTML = html;
+
+                // Paid purchases may have granted new entitlements
+                refreshEntitlements();
+            })
+            .catch(function(error) {
+                console.error('Fetch error:', error);
+            });
+        }
+
+        /**
+         * Refreshes the entitlements list
+         */
+        function refreshEntitlements() {
+            fetch('/api/entitlements', { headers: apiHeaders() })
+            .then(function(response) { return response.json(); })
+            .then(function(data) {
+                if (data.error) {
+                    console.error('Error:', data.error);
+                    return;
+                }
+
+                var container = document.getElementById('entitlements-list');
+                if (!data.entitlements || data.entitlements.length === 0) {
+                    container.innerHTML = '<p style="color: #666; text-align: center; padding: 20px;">Nothing yet. Buy a product above!</p>';
+                    return;
+                }
+
+                var html = '';
+                data.entitlements.forEach(function(ent) {
+                    var details = ent.type;
+                    if (ent.type === 'consumable') {
+                        details += ' | ' + (ent.quantity || 0) + ' left';
+                    } else if (ent.type === 'timed') {
+                        details += ' | until ' + new Date(ent.expires_at * 1000).toLocaleString();
+                    }
+
+                    html += '<div class="transaction">' +
+                        '<div class="transaction-header">' +
+                            '<span class="transaction-title">' + ent.key + '</span>' +
+                            '<span class="status ' + (ent.active ? 'status-paid' : 'status-pending') + '">' +
+                                (ent.active ? 'active' : 'inactive') +
+                            '</span>' +
+                        '</div>' +
+                        '<div class="transaction-meta">' + details + '</div>' +
+                    '</div>';
+                });
+                container.innerHTML = html;
             })
             .catch(function(error) {
                 console.error('Fetch error:', error);
@@ -1014,19 +1157,68 @@ const htmlTemplate = `<!DOCTYPE html>
 // ====================================================================================
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "sign-url" {
+		if err := runSignURL(os.Args[2:], os.Stdout); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			log.Fatalf("sign-url: %v", err)
+		}
+		return
+	}
+
 	// Log startup
 	log.Printf("Starting Ton.Place Demo App on port %s", SERVER_PORT)
-	log.Printf("App ID: %s", APP_ID)
+	log.Printf("App IDs: %s", strings.Join(appRegistry.IDs(), ", "))
 
 	// Check configuration
-	if APP_ID == "YOUR_APP_ID" || APP_SECRET == "YOUR_APP_SECRET" {
+	if APP_ID == "12345" || APP_SECRET == "YOUR_APP_SECRET" {
 		log.Println("⚠️  WARNING: Please set your APP_ID and APP_SECRET before running in production!")
 	}
 
+	// Load the product catalog
+	catalog, err := LoadCatalog(CATALOG_FILE)
+	if err != nil {
+		log.Fatalf("Failed to load product catalog: %v", err)
+	}
+	productCatalog = catalog
+	log.Printf("Loaded %d products from %s", len(catalog.Products()), CATALOG_FILE)
+
+	// Open the purchase ledger
+	ledger, err := OpenFilePurchaseStore(PURCHASE_LEDGER_FILE)
+	if err != nil {
+		log.Fatalf("Failed to open purchase ledger: %v", err)
+	}
+	purchaseLedger = ledger
+	log.Printf("Purchase ledger: %s", ledger)
+
+	// Open the entitlements and catch up on paid purchases that were never granted
+	entitlements, err := OpenFileEntitlementStore(ENTITLEMENTS_FILE)
+	if err != nil {
+		log.Fatalf("Failed to open entitlements: %v", err)
+	}
+	entitlementStore = entitlements
+	if err := applyPaidPurchases(ledger); err != nil {
+		log.Printf("Failed to apply some paid purchases: %v", err)
+	}
+
+	// Keep the ledger in sync with Ton.Place, even if users close the app mid-payment
+	purchaseReconciler.Store = ledger
+	purchaseReconciler.OnTransition(logTransition)
+	purchaseReconciler.OnTransition(grantEntitlements)
+	go purchaseReconciler.Run(context.Background(), appRegistry)
+
 	// Register HTTP handlers
-	http.HandleFunc("/", handleIndex)                             // Main page with auth
-	http.HandleFunc("/api/create-purchase", handleCreatePurchase) // Create purchase endpoint
-	http.HandleFunc("/api/transactions", handleGetTransactions)   // Get transactions for polling
+	// Every handler except favicon requires a verified Ton.Place user.
+	// The page authenticates by launch parameters or session cookie,
+	// API endpoints by the access token embedded in the page.
+	http.HandleFunc("/favicon.ico", http.NotFound)                                                  // No favicon
+	http.Handle("/", RequireTonPlaceUser(RespondHTML, http.HandlerFunc(handleIndex)))               // Main page with auth
+	http.Handle("/api/create-purchase", RequireAccessToken(http.HandlerFunc(handleCreatePurchase))) // Create purchase endpoint
+	http.Handle("/api/transactions", RequireAccessToken(http.HandlerFunc(handleGetTransactions)))   // Get transactions for polling
+	http.Handle("/api/refresh-token", RequireAccessToken(http.HandlerFunc(handleRefreshToken)))     // Extend the access token
+	http.Handle("/api/entitlements", RequireAccessToken(http.HandlerFunc(handleGetEntitlements)))   // What the user owns
 
 	// Start server
 	log.Printf("Server running at http://localhost%s", SERVER_PORT)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+// testProducts - Catalog used by tests, independent of the demo's catalog.json
+var testProducts = []Product{
+	{SKU: "basic", Title: "Basic", Amount: 100, Currency: "eur"},
+	{SKU: "once", Title: "Once per user", Amount: 500, Currency: "eur", MaxPerUser: 1,
+		Grants: []Grant{{Key: "premium", Type: GrantPermanent}}},
+	{SKU: "coins_100", Title: "100 Coins", Amount: 200, Currency: "eur",
+		Grants: []Grant{{Key: "coins", Type: GrantConsumable, Quantity: 100}}},
+}
+
+// testApp sets up a fake Ton.Place API and fresh global stores for one test.
+// The globals are restored when the test ends.
+func testApp(t *testing.T) (*tonplacetest.Server, *AppConfig) {
+	t.Helper()
+	srv := tonplacetest.NewServer("1", "test-secret")
+	t.Cleanup(srv.Close)
+
+	catalog, err := NewCatalog(testProducts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldCatalog, oldLedger, oldReconciler, oldEntitlements := productCatalog, purchaseLedger, purchaseReconciler, entitlementStore
+	oldIdempotency := purchaseIdempotency
+	t.Cleanup(func() {
+		productCatalog, purchaseLedger, purchaseReconciler, entitlementStore = oldCatalog, oldLedger, oldReconciler, oldEntitlements
+		purchaseIdempotency = oldIdempotency
+	})
+	productCatalog = catalog
+	purchaseLedger = NewMemoryPurchaseStore()
+	purchaseReconciler = NewReconciler(purchaseLedger)
+	entitlementStore = NewMemoryEntitlementStore()
+	purchaseIdempotency = NewIdempotencyStore(IDEMPOTENCY_KEY_TTL)
+
+	app := &AppConfig{
+		ID:      "1",
+		Secrets: []AppSecret{{ID: "test", Secret: "test-secret"}},
+		Client:  srv.APIClient(),
+	}
+	return srv, app
+}
+
+// withReplayGuard gives one test its own launch replay guard, so launch URLs used by
+// other tests (or earlier runs with -count) don't count as replays.
+func withReplayGuard(t *testing.T) *ReplayGuard {
+	t.Helper()
+	old := launchReplayGuard
+	t.Cleanup(func() { launchReplayGuard = old })
+	launchReplayGuard = &ReplayGuard{Store: NewMemoryReplayStore(), MaxAge: old.MaxAge, OneTimeUse: old.OneTimeUse}
+	return launchReplayGuard
+}
+
+// purchaseRequest builds an authenticated POST /api/create-purchase request.
+func purchaseRequest(ctx context.Context, app *AppConfig, userID int64, body, idempotencyKey string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/create-purchase", strings.NewReader(body)).WithContext(ctx)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	auth := &Auth{UserID: userID, App: app, Session: Session{ID: "session", AppID: app.ID, UserID: userID}}
+	return req.WithContext(withAuth(req.Context(), auth))
+}
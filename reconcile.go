@@ -0,0 +1,243 @@
+package main
+
+// ====================================================================================
+// RECONCILIATION
+// ====================================================================================
+// The browser's TonPlace.purchase callback is not a reliable signal that a payment
+// completed: the user may close the app while the payment dialog is open. The
+// reconciler polls Ton.Place in the background and brings the purchase ledger up to
+// date:
+//
+//   - Every RECONCILE_INTERVAL it pages through GET /apps/purchases?status=pending
+//     and ?status=paid for every registered app that has pending purchases younger
+//     than RECONCILE_MAX_AGE, back to shortly before the oldest of them
+//   - Purchases in the ledger whose status differs are updated; paid is final
+//   - Each status change is reported to the registered TransitionFuncs, e.g. to
+//     grant what the user bought
+//
+// Transactions fetched by the request handlers go through the same code, so a
+// change is reported once, no matter who sees it first. Purchases that are not in
+// the ledger (e.g. created by another system) are ignored.
+//
+// Abandoned payments stay pending forever. The reconciler gives up on them after
+// RECONCILE_MAX_AGE, so a pass never reads more than that window of history; a page
+// load still updates them for the user who opens the app.
+// ====================================================================================
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// RECONCILE_INTERVAL - How often the reconciler polls Ton.Place
+const RECONCILE_INTERVAL = 30 * time.Second
+
+// RECONCILE_MAX_AGE - Pending purchases older than this are no longer reconciled
+const RECONCILE_MAX_AGE = 24 * time.Hour
+
+// RECONCILE_LOOKBACK - How far before the oldest reconciled pending purchase the
+// reconciler pages. Older purchases can't be a new transition, so paging stops
+// there. Covers clock differences with Ton.Place.
+const RECONCILE_LOOKBACK = time.Hour
+
+// RECONCILE_PASS_TIMEOUT - Deadline of one pass over all apps, including waits
+// for the rate limiter shared with user requests
+const RECONCILE_PASS_TIMEOUT = 20 * time.Second
+
+// PurchaseTransition describes a status change of a purchase in the ledger.
+type PurchaseTransition struct {
+	// Record - Ledger record after the change
+	Record PurchaseRecord
+
+	// From, To - Previous and new status
+	From string
+	To   string
+}
+
+// TransitionFunc is called for every status change detected by the Reconciler.
+// Returned errors are logged; the change is not reported again.
+type TransitionFunc func(ctx context.Context, t PurchaseTransition) error
+
+// purchaseReconciler keeps the purchase ledger in sync with Ton.Place.
+// main points it at the file-backed ledger and starts it.
+var purchaseReconciler = NewReconciler(purchaseLedger)
+
+// Reconciler updates a PurchaseStore with purchase statuses from Ton.Place
+// and reports status changes. It is safe for concurrent use.
+type Reconciler struct {
+	// Store - Ledger to update
+	Store PurchaseStore
+
+	// Interval - Time between two passes of Run
+	Interval time.Duration
+
+	// MaxAge - Pending purchases older than this are not reconciled
+	MaxAge time.Duration
+
+	// PassTimeout - Deadline of one pass of Run
+	PassTimeout time.Duration
+
+	mu        sync.RWMutex
+	callbacks []TransitionFunc
+}
+
+// NewReconciler creates a reconciler for store with the default settings.
+func NewReconciler(store PurchaseStore) *Reconciler {
+	return &Reconciler{
+		Store:       store,
+		Interval:    RECONCILE_INTERVAL,
+		MaxAge:      RECONCILE_MAX_AGE,
+		PassTimeout: RECONCILE_PASS_TIMEOUT,
+	}
+}
+
+// OnTransition registers fn to be called for every detected status change.
+// Callbacks run one after another, in registration order.
+func (r *Reconciler) OnTransition(fn TransitionFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.callbacks = append(r.callbacks, fn)
+}
+
+// Run reconciles all apps of apps immediately and then every Interval,
+// until ctx is cancelled. Each pass is cancelled after PassTimeout.
+// Errors are logged and don't stop the loop.
+func (r *Reconciler) Run(ctx context.Context, apps *AppRegistry) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		passCtx, cancel := context.WithTimeout(ctx, r.PassTimeout)
+		err := r.ReconcileAll(passCtx, apps)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Reconciliation failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileAll runs one reconciliation pass for every app of the registry.
+// A failing app doesn't stop the others; all errors are returned together.
+func (r *Reconciler) ReconcileAll(ctx context.Context, apps *AppRegistry) error {
+	var errs []error
+	for _, id := range apps.IDs() {
+		app, _ := apps.Lookup(id)
+		if err := r.Reconcile(ctx, app.ID, app.Client); err != nil {
+			errs = append(errs, fmt.Errorf("app %s: %w", app.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reconcile pages through the pending and paid purchases of one app and applies
+// their statuses to the ledger. Only the history since shortly before the oldest
+// pending purchase younger than MaxAge is read; without such purchases there is
+// nothing that could change and no request is made.
+func (r *Reconciler) Reconcile(ctx context.Context, appID string, client *tonplace.Client) error {
+	pending, err := r.Store.ByStatus(tonplace.StatusPending)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-r.MaxAge).Unix()
+	var oldestPending int64
+	for _, rec := range pending {
+		if rec.AppID == appID && rec.CreatedAt >= cutoff {
+			oldestPending = rec.CreatedAt // ByStatus returns oldest first
+			break
+		}
+	}
+	if oldestPending == 0 {
+		return nil
+	}
+	stopBefore := oldestPending - int64(RECONCILE_LOOKBACK/time.Second)
+
+	// Pending purchases: usually unchanged; paid records are never moved back
+	if err := r.reconcileStatus(ctx, appID, client, tonplace.StatusPending, stopBefore); err != nil {
+		return err
+	}
+
+	// Paid purchases: the transitions we are looking for
+	return r.reconcileStatus(ctx, appID, client, tonplace.StatusPaid, stopBefore)
+}
+
+// reconcileStatus applies purchases with status to the ledger, newest first.
+// Paging stops at the first purchase created before stopBefore.
+func (r *Reconciler) reconcileStatus(ctx context.Context, appID string, client *tonplace.Client, status string, stopBefore int64) error {
+	batch := make([]tonplace.Transaction, 0, tonplace.MaxPageSize)
+	for tx, err := range client.AllPurchases(ctx, tonplace.ListPurchasesOptions{Status: status}, 0) {
+		if err != nil {
+			return err
+		}
+		if tx.CreatedAt < stopBefore {
+			break
+		}
+		batch = append(batch, tx)
+		if len(batch) == cap(batch) {
+			r.Observe(ctx, appID, batch)
+			batch = batch[:0]
+		}
+	}
+	r.Observe(ctx, appID, batch)
+	return nil
+}
+
+// Observe applies statuses of transactions fetched from Ton.Place to the ledger
+// and reports every change. Purchases that are not in the ledger are ignored.
+//
+// Paid is final: transactions may come from a page fetched before the purchase was
+// paid, so a stale "pending" never moves a paid record back.
+func (r *Reconciler) Observe(ctx context.Context, appID string, transactions []tonplace.Transaction) {
+	now := time.Now()
+	for _, tx := range transactions {
+		before, err := r.Store.Get(appID, tx.ID)
+		if err != nil || before.Status == tx.Status || before.Status == tonplace.StatusPaid {
+			continue
+		}
+		rec, changed, err := r.Store.UpdateStatus(appID, tx.ID, tx.Status, now)
+		if err != nil {
+			log.Printf("Failed to update purchase %d in ledger: %v", tx.ID, err)
+			continue
+		}
+		if !changed {
+			continue // Someone else recorded the change first
+		}
+		r.notify(ctx, PurchaseTransition{Record: rec, From: before.Status, To: rec.Status})
+	}
+}
+
+// notify calls all callbacks for t. A panicking callback is logged and skipped.
+func (r *Reconciler) notify(ctx context.Context, t PurchaseTransition) {
+	r.mu.RLock()
+	callbacks := r.callbacks
+	r.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("Transition callback for purchase %d panicked: %v", t.Record.PurchaseID, p)
+				}
+			}()
+			if err := fn(ctx, t); err != nil {
+				log.Printf("Transition callback for purchase %d failed: %v", t.Record.PurchaseID, err)
+			}
+		}()
+	}
+}
+
+// logTransition is a TransitionFunc writing status changes to the server log.
+func logTransition(_ context.Context, t PurchaseTransition) error {
+	log.Printf("Purchase %d (order %s, sku %s) of user %d: %s -> %s",
+		t.Record.PurchaseID, t.Record.OrderID, t.Record.SKU, t.Record.UserID, t.From, t.To)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+func TestReconcilerObserve(t *testing.T) {
+	tests := []struct {
+		name       string
+		observed   []string // Status reported by Ton.Place, one Observe call each
+		want       []string // Reported transitions
+		wantStatus string
+	}{
+		{
+			name:       "pending to paid",
+			observed:   []string{tonplace.StatusPending, tonplace.StatusPaid},
+			want:       []string{"pending->paid"},
+			wantStatus: tonplace.StatusPaid,
+		},
+		{
+			name:       "paid is reported once",
+			observed:   []string{tonplace.StatusPaid, tonplace.StatusPaid},
+			want:       []string{"pending->paid"},
+			wantStatus: tonplace.StatusPaid,
+		},
+		{
+			name:       "stale pending never moves a paid purchase back",
+			observed:   []string{tonplace.StatusPaid, tonplace.StatusPending, tonplace.StatusPaid},
+			want:       []string{"pending->paid"},
+			wantStatus: tonplace.StatusPaid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryPurchaseStore()
+			store.Add(PurchaseRecord{PurchaseID: 1, AppID: "1", UserID: 5, SKU: "basic", Status: tonplace.StatusPending})
+
+			r := NewReconciler(store)
+			var got []string
+			r.OnTransition(func(_ context.Context, tr PurchaseTransition) error {
+				got = append(got, tr.From+"->"+tr.To)
+				return nil
+			})
+
+			for _, status := range tt.observed {
+				r.Observe(context.Background(), "1", []tonplace.Transaction{{ID: 1, Status: status}})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+			rec, _ := store.Get("1", 1)
+			if rec.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", rec.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReconcilerObserveIgnoresUnknownPurchases(t *testing.T) {
+	r := NewReconciler(NewMemoryPurchaseStore())
+	called := false
+	r.OnTransition(func(context.Context, PurchaseTransition) error { called = true; return nil })
+	r.Observe(context.Background(), "1", []tonplace.Transaction{{ID: 99, Status: tonplace.StatusPaid}})
+	if called {
+		t.Error("callback called for a purchase that is not in the ledger")
+	}
+}
+
+func TestReconcilerCallbackFailuresDontStopOthers(t *testing.T) {
+	store := NewMemoryPurchaseStore()
+	store.Add(PurchaseRecord{PurchaseID: 1, AppID: "1", Status: tonplace.StatusPending})
+	r := NewReconciler(store)
+
+	var calls []string
+	r.OnTransition(func(context.Context, PurchaseTransition) error {
+		calls = append(calls, "error")
+		return fmt.Errorf("failed")
+	})
+	r.OnTransition(func(context.Context, PurchaseTransition) error { calls = append(calls, "panic"); panic("boom") })
+	r.OnTransition(func(context.Context, PurchaseTransition) error { calls = append(calls, "ok"); return nil })
+
+	r.Observe(context.Background(), "1", []tonplace.Transaction{{ID: 1, Status: tonplace.StatusPaid}})
+	if want := []string{"error", "panic", "ok"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("callbacks = %v, want %v", calls, want)
+	}
+}
+
+func TestPurchaseStorePaidIsFinal(t *testing.T) {
+	store := NewMemoryPurchaseStore()
+	store.Add(PurchaseRecord{PurchaseID: 1, AppID: "1", Status: tonplace.StatusPending})
+	at := time.Unix(1_000_000, 0)
+
+	if _, changed, _ := store.UpdateStatus("1", 1, tonplace.StatusPaid, at); !changed {
+		t.Fatal("pending -> paid not applied")
+	}
+	rec, changed, err := store.UpdateStatus("1", 1, tonplace.StatusPending, at.Add(time.Minute))
+	if err != nil || changed || rec.Status != tonplace.StatusPaid || rec.PaidAt != at.Unix() {
+		t.Errorf("paid -> pending: rec=%+v changed=%v err=%v, want unchanged paid record", rec, changed, err)
+	}
+}
+
+func TestReconcileScanIsBounded(t *testing.T) {
+	srv, app := testApp(t)
+	store := NewMemoryPurchaseStore()
+	r := NewReconciler(store)
+	now := time.Now()
+
+	// A month of old history, including an abandoned payment
+	for i := 0; i < 5*tonplace.MaxPageSize; i++ {
+		srv.AddPurchase(tonplace.Transaction{UserID: 9, Amount: 100, Title: "Old", Status: tonplace.StatusPaid, CreatedAt: now.AddDate(0, -1, 0).Unix()})
+	}
+	abandoned := srv.AddPurchase(tonplace.Transaction{UserID: 9, Amount: 100, Title: "Old", CreatedAt: now.AddDate(0, -1, 0).Unix()})
+	store.Add(PurchaseRecord{PurchaseID: abandoned, AppID: app.ID, Status: tonplace.StatusPending, CreatedAt: now.AddDate(0, -1, 0).Unix()})
+
+	// Only abandoned payments: nothing to reconcile, no requests
+	before := srv.Requests()
+	if err := r.Reconcile(context.Background(), app.ID, app.Client); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests() - before; n != 0 {
+		t.Errorf("made %d requests for abandoned payments only, want 0", n)
+	}
+
+	// A recent payment: found without reading the old history
+	recent := srv.AddPurchase(tonplace.Transaction{UserID: 5, Amount: 100, Title: "Demo Purchase", CreatedAt: now.Unix()})
+	store.Add(PurchaseRecord{PurchaseID: recent, AppID: app.ID, Status: tonplace.StatusPending, CreatedAt: now.Unix()})
+	srv.MarkPaid(recent)
+
+	before = srv.Requests()
+	if err := r.Reconcile(context.Background(), app.ID, app.Client); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests() - before; n > 2 {
+		t.Errorf("made %d requests, want at most one page per status", n)
+	}
+	if rec, _ := store.Get(app.ID, recent); rec.Status != tonplace.StatusPaid {
+		t.Errorf("recent purchase status = %q, want paid", rec.Status)
+	}
+}
+
+func TestReconcileRespectsDeadline(t *testing.T) {
+	srv, app := testApp(t)
+	srv.SetLatency(time.Second)
+	store := NewMemoryPurchaseStore()
+	store.Add(PurchaseRecord{PurchaseID: 1, AppID: app.ID, Status: tonplace.StatusPending, CreatedAt: time.Now().Unix()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := NewReconciler(store).Reconcile(ctx, app.ID, app.Client); err == nil {
+		t.Fatal("Reconcile succeeded after its deadline")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Reconcile took %v after a 50ms deadline", d)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+// ====================================================================================
+// REPLAY PROTECTION
+// ====================================================================================
+// ValidateTimestamp only limits the age of a launch signature. Within that window
+// a leaked launch URL (browser history, logs, a shared link) could be opened by
+// anyone. The replay guard remembers every launch signature it accepted until the
+// signature expires and rejects a second use:
+//
+//   - Default mode: the launch URL may be opened again only by the browser that
+//     opened it first (identified by its session ID), e.g. on a page reload
+//   - One-time-use mode: every launch URL is accepted exactly once
+//
+// Seen launches are kept in a ReplayStore. MemoryReplayStore works for a single
+// server instance; implement ReplayStore on top of Redis or a database when
+// running several instances.
+// ====================================================================================
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// REPLAY_ONE_TIME_USE - Accept each launch URL only once, even from the same browser
+// Page reloads still work through the session cookie
+const REPLAY_ONE_TIME_USE = false
+
+// errReplayedLaunch - The launch signature was already used
+var errReplayedLaunch = errors.New("launch signature already used")
+
+// ReplayStore remembers launch signatures until they expire.
+// Implementations must be safe for concurrent use.
+type ReplayStore interface {
+	// Claim records key as used by owner until expiresAt.
+	// If key is already recorded and not yet expired, the record is left unchanged
+	// and Claim returns the owner of the first use with claimed == false.
+	Claim(key, owner string, expiresAt time.Time) (firstOwner string, claimed bool, err error)
+}
+
+// ReplayGuard rejects launch parameters that were already used.
+type ReplayGuard struct {
+	// Store - Where used launch signatures are kept
+	Store ReplayStore
+
+	// MaxAge - How long a launch signature stays valid after its timestamp
+	// Entries are kept until then; afterwards ValidateTimestamp rejects the launch anyway
+	MaxAge time.Duration
+
+	// OneTimeUse - Reject any second use, even by the browser that used it first
+	OneTimeUse bool
+}
+
+// launchReplayGuard protects handleIndex against reuse of launch URLs.
+// The extra minute covers the future-timestamp tolerance of ValidateTimestamp.
+var launchReplayGuard = &ReplayGuard{
+	Store:      NewMemoryReplayStore(),
+	MaxAge:     SIGNATURE_MAX_AGE*time.Second + time.Minute,
+	OneTimeUse: REPLAY_ONE_TIME_USE,
+}
+
+// Check records the launch as used by the session sessionID.
+// It returns errReplayedLaunch if the launch was already used - by another
+// session, or by any session in one-time-use mode.
+// Call it only after the signature was verified.
+func (g *ReplayGuard) Check(params UserParams, sessionID string) error {
+	ts, err := strconv.ParseInt(params.Timestamp, 10, 64)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Unix(ts, 0).Add(g.MaxAge)
+
+	firstOwner, claimed, err := g.Store.Claim(replayKey(params), sessionID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if claimed {
+		return nil
+	}
+	if !g.OneTimeUse && firstOwner == sessionID {
+		return nil
+	}
+	return errReplayedLaunch
+}
+
+// replayKey identifies a launch. The verified hash covers all launch parameters,
+// so two launches share a key only if they are byte-for-byte identical.
+func replayKey(params UserParams) string {
+	return params.AppID + ":" + strings.ToLower(params.Hash)
+}
+
+// ====================================================================================
+// IN-MEMORY REPLAY STORE
+// ====================================================================================
+
+// replaySweepInterval - How often expired entries are removed from memory
+const replaySweepInterval = time.Minute
+
+// replayEntry is a launch signature remembered by MemoryReplayStore.
+type replayEntry struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// MemoryReplayStore is a ReplayStore keeping entries in process memory.
+// Expired entries are removed lazily, at most once per replaySweepInterval.
+type MemoryReplayStore struct {
+	mu        sync.Mutex
+	entries   map[string]replayEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryReplayStore creates an empty in-memory replay store.
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{
+		entries: make(map[string]replayEntry),
+		now:     time.Now,
+	}
+}
+
+// Claim implements ReplayStore.
+func (s *MemoryReplayStore) Claim(key, owner string, expiresAt time.Time) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= replaySweepInterval {
+		for k, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expiresAt) {
+		return e.owner, false, nil
+	}
+	s.entries[key] = replayEntry{owner: owner, expiresAt: expiresAt}
+	return owner, true, nil
+}
+
+// Len returns the number of remembered launches, including expired ones not yet swept.
+func (s *MemoryReplayStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
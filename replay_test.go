@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplayGuardCheck(t *testing.T) {
+	launch := UserParams{AppID: "1", UserID: "42", Timestamp: strconv.FormatInt(time.Now().Unix(), 10), Hash: "abc"}
+	other := launch
+	other.Hash = "def"
+
+	type use struct {
+		params    UserParams
+		sessionID string
+		wantErr   error
+	}
+	tests := []struct {
+		name       string
+		oneTimeUse bool
+		uses       []use
+	}{
+		{
+			name: "reload in the same session",
+			uses: []use{{launch, "a", nil}, {launch, "a", nil}},
+		},
+		{
+			name: "second use from another session",
+			uses: []use{{launch, "a", nil}, {launch, "b", errReplayedLaunch}, {launch, "a", nil}},
+		},
+		{
+			name:       "one-time use rejects the same session",
+			oneTimeUse: true,
+			uses:       []use{{launch, "a", nil}, {launch, "a", errReplayedLaunch}},
+		},
+		{
+			name: "hash is compared case-insensitively",
+			uses: []use{{launch, "a", nil}, {UserParams{AppID: "1", Timestamp: launch.Timestamp, Hash: "ABC"}, "b", errReplayedLaunch}},
+		},
+		{
+			name: "different launches",
+			uses: []use{{launch, "a", nil}, {other, "b", nil}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &ReplayGuard{Store: NewMemoryReplayStore(), MaxAge: time.Minute, OneTimeUse: tt.oneTimeUse}
+			for i, u := range tt.uses {
+				if err := g.Check(u.params, u.sessionID); !errors.Is(err, u.wantErr) {
+					t.Errorf("use %d by %s: err = %v, want %v", i, u.sessionID, err, u.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryReplayStoreExpiry(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewMemoryReplayStore()
+	s.now = func() time.Time { return now }
+
+	if _, claimed, _ := s.Claim("k", "a", now.Add(time.Minute)); !claimed {
+		t.Fatal("first claim failed")
+	}
+	s.Claim("short", "a", now.Add(time.Second))
+
+	// Still valid - the first owner is reported
+	now = now.Add(30 * time.Second)
+	if owner, claimed, _ := s.Claim("k", "b", now.Add(time.Minute)); claimed || owner != "a" {
+		t.Errorf("claim before expiry = %q, %v; want \"a\", false", owner, claimed)
+	}
+
+	// Expired but not yet swept: can be claimed again right away
+	if owner, claimed, _ := s.Claim("short", "b", now.Add(time.Minute)); !claimed || owner != "b" {
+		t.Errorf("claim after expiry = %q, %v; want \"b\", true", owner, claimed)
+	}
+
+	// After replaySweepInterval the expired entry is removed from memory
+	now = now.Add(replaySweepInterval)
+	s.Claim("other", "c", now.Add(time.Second))
+	if n := s.Len(); n != 1 {
+		t.Errorf("Len after sweep = %d, want 1", n)
+	}
+	if _, claimed, _ := s.Claim("k", "b", now.Add(time.Minute)); !claimed {
+		t.Error("swept entry could not be claimed again")
+	}
+}
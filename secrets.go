@@ -0,0 +1,77 @@
+package main
+
+// ====================================================================================
+// SECRET ROTATION
+// ====================================================================================
+// Changing the app secret in the Ton.Place developer panel would invalidate every
+// launch URL signed with the old secret. To rotate without downtime, keep the old
+// secret in APP_SECRETS for a while and give it a ValidUntil time:
+//
+//	var APP_SECRETS = []AppSecret{
+//	    {ID: "2026-11", Secret: "NEW_SECRET"},
+//	    {ID: "2026-10", Secret: "OLD_SECRET", ValidUntil: time.Date(2026, 11, 15, 0, 0, 0, 0, time.UTC)},
+//	}
+//
+// Every launch is checked against all active secrets. The server logs when traffic
+// is still signed with an old secret, so you know when it's safe to remove it.
+// ====================================================================================
+
+import (
+	"crypto/subtle"
+	"time"
+)
+
+// AppSecret is one of the secrets accepted for launch signatures.
+type AppSecret struct {
+	// ID - Label used in logs to tell secrets apart (never log the secret itself)
+	ID string
+
+	// Secret - The app secret
+	Secret string
+
+	// ValidUntil - Signatures made with this secret are rejected after this time
+	// Zero value means the secret does not expire
+	ValidUntil time.Time
+}
+
+// APP_SECRETS - Secrets accepted for launch signatures, current secret first.
+// Add the previous secret with a ValidUntil time while rotating.
+var APP_SECRETS = []AppSecret{
+	{ID: "current", Secret: APP_SECRET},
+}
+
+// activeAt reports whether the secret may be used at time now.
+func (s AppSecret) activeAt(now time.Time) bool {
+	return s.ValidUntil.IsZero() || now.Before(s.ValidUntil)
+}
+
+// VerifySignatureWithSecrets validates the launch signature against every secret
+// that is active at time now. It returns the ID of the matching secret.
+//
+// All active secrets are always checked, and the hashes are compared in constant
+// time, so the response time does not reveal which secret matched.
+func VerifySignatureWithSecrets(queryParams map[string][]string, secrets []AppSecret, now time.Time) (secretID string, ok bool) {
+	params := launchParams(queryParams)
+
+	providedHash := ""
+	if hashValues, found := queryParams["hash"]; found && len(hashValues) > 0 {
+		providedHash = hashValues[0]
+	}
+
+	matched := -1
+	for i, secret := range secrets {
+		if !secret.activeAt(now) {
+			continue
+		}
+		expectedHash := SignParams(params, secret.Secret)
+		// Remember the first match without branching on secret data
+		isMatch := subtle.ConstantTimeCompare([]byte(expectedHash), []byte(providedHash))
+		notYet := subtle.ConstantTimeEq(int32(matched), -1)
+		matched = subtle.ConstantTimeSelect(isMatch&notYet, i, matched)
+	}
+
+	if matched < 0 {
+		return "", false
+	}
+	return secrets[matched].ID, true
+}
@@ -0,0 +1,232 @@
+package main
+
+// ====================================================================================
+// SESSIONS
+// ====================================================================================
+// The launch signature is only valid for SIGNATURE_MAX_AGE seconds, so it can't be
+// used to authenticate page reloads or API calls made later. After a successful
+// launch verification the server issues its own session cookie instead.
+//
+// Cookie format: base64url(JSON payload) + "." + base64url(HMAC-SHA256(payload))
+//
+// The payload is not encrypted - it only holds the data Ton.Place already sent in
+// the launch URL - but it can't be modified without invalidating the signature.
+// The signing key is derived from the secret of the session's app, so it never
+// leaves the server, and rotating one app's secret doesn't affect other apps.
+// Cookies signed with an older secret stay valid while that secret is active
+// (see AppSecret.ValidUntil).
+// ====================================================================================
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SESSION_COOKIE_NAME - Name of the cookie holding the signed session
+	SESSION_COOKIE_NAME = "tp_session"
+
+	// SESSION_MAX_AGE - How long a session stays valid after launch (24 hours)
+	SESSION_MAX_AGE = 24 * time.Hour
+)
+
+var (
+	errNoSession      = errors.New("no session cookie")
+	errBadSession     = errors.New("malformed or tampered session cookie")
+	errExpiredSession = errors.New("session expired")
+
+	errUnknownSessionApp = errors.New("session belongs to an app that is not registered")
+
+	errBadSignedValue = errors.New("malformed or tampered signed value")
+)
+
+// Session is the server-side record of an authenticated user, stored in a signed cookie.
+type Session struct {
+	// ID - Random session identifier, unique per launch
+	ID string `json:"sid"`
+
+	// AppID - Application the user launched
+	AppID string `json:"app"`
+
+	// UserID - Verified Ton.Place user ID
+	UserID int64 `json:"uid"`
+
+	// FirstName, LastName - Display names received at launch
+	FirstName string `json:"fn,omitempty"`
+	LastName  string `json:"ln,omitempty"`
+
+	// ExpiresAt - Unix timestamp after which the session is rejected
+	ExpiresAt int64 `json:"exp"`
+}
+
+// UserParams returns the session user in the same shape as verified launch parameters.
+// Timestamp and Hash are empty because no launch signature is involved.
+func (s Session) UserParams() UserParams {
+	return UserParams{
+		AppID:     s.AppID,
+		UserID:    strconv.FormatInt(s.UserID, 10),
+		FirstName: s.FirstName,
+		LastName:  s.LastName,
+	}
+}
+
+// Purposes of the keys derived by deriveKey
+const (
+	sessionKeyPurpose     = "session v1"
+	accessTokenKeyPurpose = "access token v1"
+)
+
+// deriveKey returns an HMAC key for one purpose (sessions, access tokens) of one app,
+// derived from one of the app's secrets. Different purposes and apps get different
+// keys, so a signature made for one can never be accepted as another - or as a
+// launch signature.
+func deriveKey(appID string, secret AppSecret, purpose string) []byte {
+	h := hmac.New(sha256.New, []byte(secret.Secret))
+	h.Write([]byte("tonplace-demo " + purpose + " app " + appID))
+	return h.Sum(nil)
+}
+
+// newSession creates a session for a user whose launch parameters were verified.
+func newSession(params UserParams, userID int64) (Session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Session{}, err
+	}
+	return Session{
+		ID:        hex.EncodeToString(id),
+		AppID:     params.AppID,
+		UserID:    userID,
+		FirstName: params.FirstName,
+		LastName:  params.LastName,
+		ExpiresAt: time.Now().Add(SESSION_MAX_AGE).Unix(),
+	}, nil
+}
+
+// encodeSession serializes and signs a session for use as cookie value.
+func encodeSession(s Session) (string, error) {
+	return encodeSigned(s.AppID, sessionKeyPurpose, s)
+}
+
+// decodeSession verifies the signature and expiry of a cookie value and returns
+// the session together with the configuration of its app.
+func decodeSession(value string) (Session, *AppConfig, error) {
+	var s Session
+	app, err := decodeSigned(sessionKeyPurpose, value, &s)
+	if errors.Is(err, errUnknownSessionApp) {
+		return Session{}, nil, err
+	}
+	if err != nil || s.UserID <= 0 || s.ID == "" {
+		return Session{}, nil, errBadSession
+	}
+	if time.Now().Unix() >= s.ExpiresAt {
+		return Session{}, nil, errExpiredSession
+	}
+	return s, app, nil
+}
+
+// encodeSigned serializes v as JSON and signs it with the key for purpose, derived
+// from the current secret of app appID.
+// Format: base64url(JSON payload) + "." + base64url(HMAC-SHA256(payload))
+func encodeSigned(appID, purpose string, v interface{}) (string, error) {
+	app, ok := appRegistry.Lookup(appID)
+	if !ok {
+		return "", errUnknownSessionApp
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, deriveKey(app.ID, app.Secrets[0], purpose))
+	h.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// decodeSigned verifies a value produced by encodeSigned and parses its payload into v.
+// Returns the configuration of the app the value was signed for.
+//
+// The app ID is read from the "app" field of the payload first, because it selects
+// the key. The signature covers that field, so a value can't be moved to another app.
+// Every active secret of the app is tried, so values signed before a secret rotation
+// stay valid while the old secret does.
+func decodeSigned(purpose, value string, v interface{}) (*AppConfig, error) {
+	payloadPart, sigPart, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errBadSignedValue
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, errBadSignedValue
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return nil, errBadSignedValue
+	}
+
+	// Find the app - nothing else of the payload is used before the signature is checked
+	var head struct {
+		AppID string `json:"app"`
+	}
+	if err := json.Unmarshal(payload, &head); err != nil {
+		return nil, errBadSignedValue
+	}
+	app, ok := appRegistry.Lookup(head.AppID)
+	if !ok {
+		return nil, errUnknownSessionApp
+	}
+
+	// Check the signature against every active secret (constant-time comparison)
+	now := time.Now()
+	for _, secret := range app.Secrets {
+		if !secret.activeAt(now) {
+			continue
+		}
+		h := hmac.New(sha256.New, deriveKey(app.ID, secret, purpose))
+		h.Write(payload)
+		if hmac.Equal(sig, h.Sum(nil)) {
+			return app, json.Unmarshal(payload, v)
+		}
+	}
+	return nil, errBadSignedValue
+}
+
+// setSessionCookie stores the session in the browser.
+// SameSite=None is required because the app runs in an iframe inside Ton.Place,
+// which in turn requires Secure (browsers treat http://localhost as secure).
+func setSessionCookie(w http.ResponseWriter, s Session) error {
+	value, err := encodeSession(s)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE_NAME,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Unix(s.ExpiresAt, 0),
+		MaxAge:   int(time.Until(time.Unix(s.ExpiresAt, 0)).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	return nil
+}
+
+// sessionFromRequest returns the valid session of the request, if any,
+// together with the configuration of the app the session belongs to.
+// Sessions of apps that are no longer registered are rejected.
+func sessionFromRequest(r *http.Request) (Session, *AppConfig, error) {
+	cookie, err := r.Cookie(SESSION_COOKIE_NAME)
+	if err != nil {
+		return Session{}, nil, errNoSession
+	}
+	return decodeSession(cookie.Value)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withApps replaces appRegistry for one test.
+func withApps(t *testing.T, apps ...*AppConfig) {
+	t.Helper()
+	old := appRegistry
+	t.Cleanup(func() { appRegistry = old })
+	appRegistry = mustAppRegistry(apps...)
+}
+
+// moveToApp rewrites the app ID in the payload of a signed value, keeping the signature.
+func moveToApp(value, from, to string) string {
+	payloadPart, sig, _ := strings.Cut(value, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(payloadPart)
+	payload = []byte(strings.Replace(string(payload), `"app":"`+from+`"`, `"app":"`+to+`"`, 1))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + sig
+}
+
+func TestSessionKeysPerApp(t *testing.T) {
+	session := Session{ID: "sid", AppID: "1", UserID: 42, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	sameSecret := []AppSecret{{ID: "current", Secret: "shared"}}
+
+	tests := []struct {
+		name    string
+		signed  []*AppConfig // Registry when the session is issued
+		checked []*AppConfig // Registry when the session comes back
+		value   func(string) string
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			signed:  []*AppConfig{{ID: "1", Secrets: sameSecret}},
+			checked: []*AppConfig{{ID: "1", Secrets: sameSecret}},
+		},
+		{
+			name:   "old secret still active after rotation",
+			signed: []*AppConfig{{ID: "1", Secrets: []AppSecret{{ID: "old", Secret: "a"}}}},
+			checked: []*AppConfig{{ID: "1", Secrets: []AppSecret{
+				{ID: "new", Secret: "b"},
+				{ID: "old", Secret: "a", ValidUntil: time.Now().Add(time.Hour)},
+			}}},
+		},
+		{
+			name:    "old secret removed",
+			signed:  []*AppConfig{{ID: "1", Secrets: []AppSecret{{ID: "old", Secret: "a"}}}},
+			checked: []*AppConfig{{ID: "1", Secrets: []AppSecret{{ID: "new", Secret: "b"}}}},
+			wantErr: errBadSession,
+		},
+		{
+			name:   "other app rotated its secret",
+			signed: []*AppConfig{{ID: "1", Secrets: sameSecret}, {ID: "2", Secrets: []AppSecret{{ID: "old", Secret: "a"}}}},
+			checked: []*AppConfig{
+				{ID: "1", Secrets: sameSecret},
+				{ID: "2", Secrets: []AppSecret{{ID: "new", Secret: "b"}}},
+			},
+		},
+		{
+			name:    "moved to another app with the same secret",
+			signed:  []*AppConfig{{ID: "1", Secrets: sameSecret}, {ID: "2", Secrets: sameSecret}},
+			checked: []*AppConfig{{ID: "1", Secrets: sameSecret}, {ID: "2", Secrets: sameSecret}},
+			value:   func(v string) string { return moveToApp(v, "1", "2") },
+			wantErr: errBadSession,
+		},
+		{
+			name:    "app no longer registered",
+			signed:  []*AppConfig{{ID: "1", Secrets: sameSecret}},
+			checked: []*AppConfig{{ID: "2", Secrets: sameSecret}},
+			wantErr: errUnknownSessionApp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withApps(t, tt.signed...)
+			value, err := encodeSession(session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.value != nil {
+				value = tt.value(value)
+			}
+
+			appRegistry = mustAppRegistry(tt.checked...)
+			got, app, err := decodeSession(value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got != session || app.ID != session.AppID) {
+				t.Errorf("got %+v of app %s, want %+v", got, app.ID, session)
+			}
+		})
+	}
+}
+
+func TestSessionAndTokenKeysDiffer(t *testing.T) {
+	withApps(t, &AppConfig{ID: "1", Secrets: []AppSecret{{ID: "current", Secret: "s"}}})
+	session := Session{ID: "sid", AppID: "1", UserID: 42, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	cookie, err := encodeSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := issueAccessToken(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := parseAccessToken(cookie); !errors.Is(err, errBadToken) {
+		t.Errorf("session cookie accepted as access token: %v", err)
+	}
+	if _, _, err := decodeSession(token); !errors.Is(err, errBadSession) {
+		t.Errorf("access token accepted as session cookie: %v", err)
+	}
+	if tok, app, err := parseAccessToken(token); err != nil || tok.session() != session || app.ID != "1" {
+		t.Errorf("parseAccessToken = %+v, %v", tok, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignURL(t *testing.T) {
+	// The server's clock is stopped at the launch time passed with -ts
+	launchedAt := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(launchedAt.Unix(), 10)
+	verifier := NewVerifier(APP_SECRETS)
+	verifier.Clock = fakeClock{launchedAt}
+	withApps(t, &AppConfig{ID: APP_ID, Secrets: APP_SECRETS, Verifier: verifier})
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "defaults", args: []string{"-user-id", "42", "-ts", ts}},
+		{name: "extra parameters", args: []string{"-user-id", "42", "-ts", ts, "-first-name", "Ada", "-param", "ref=promo"}},
+		{name: "non-numeric app id", args: []string{"-user-id", "42", "-app-id", "demo", "-secret", "s"}, wantErr: "app_id must be numeric"},
+		{name: "non-numeric ts", args: []string{"-user-id", "42", "-ts", "-5"}, wantErr: "ts must be numeric"},
+		{name: "missing user id", args: nil, wantErr: "-user-id is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withReplayGuard(t)
+			var out bytes.Buffer
+			err := runSignURL(tt.args, &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The server must accept the URL it printed
+			r := httptest.NewRequest("GET", strings.TrimSpace(out.String()), nil)
+			auth, _, msg := authenticate(httptest.NewRecorder(), r)
+			if auth == nil {
+				t.Fatalf("launch rejected: %s", msg)
+			}
+		})
+	}
+}
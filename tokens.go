@@ -0,0 +1,188 @@
+package main
+
+// ====================================================================================
+// ACCESS TOKENS
+// ====================================================================================
+// Browsers often block third-party cookies inside the Ton.Place iframe, so the
+// session cookie can't be relied on for the page's JavaScript API calls.
+// Instead, handleIndex embeds a short-lived signed access token in the page, and
+// the JavaScript sends it with every API call:
+//
+//	Authorization: Bearer <token>
+//
+// Before the token expires, the page calls POST /api/refresh-token with the
+// current token to get a new one. A token chain can be refreshed until the
+// session it was issued for expires (SESSION_MAX_AGE); after that the user
+// has to reopen the app from Ton.Place.
+//
+// Token format is the same as the session cookie (signed JSON payload), with a
+// separate signing key so a session cookie can't be used as token and vice versa.
+// Like the session key, it is derived from the secret of the token's app.
+// ====================================================================================
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ACCESS_TOKEN_TTL - Lifetime of a single access token
+const ACCESS_TOKEN_TTL = 15 * time.Minute
+
+var (
+	errNoToken      = errors.New("no bearer token")
+	errBadToken     = errors.New("malformed or tampered access token")
+	errExpiredToken = errors.New("access token expired")
+)
+
+// accessToken is the payload of an access token.
+type accessToken struct {
+	// SessionID - Session the token belongs to
+	SessionID string `json:"sid"`
+
+	// AppID, UserID, FirstName, LastName - Verified user, copied from the session
+	AppID     string `json:"app"`
+	UserID    int64  `json:"uid"`
+	FirstName string `json:"fn,omitempty"`
+	LastName  string `json:"ln,omitempty"`
+
+	// ExpiresAt - Unix timestamp after which the token is rejected
+	ExpiresAt int64 `json:"exp"`
+
+	// SessionExpiresAt - Refreshing never extends the token beyond this time
+	SessionExpiresAt int64 `json:"sexp"`
+}
+
+// session reconstructs the session the token was issued for.
+func (t accessToken) session() Session {
+	return Session{
+		ID:        t.SessionID,
+		AppID:     t.AppID,
+		UserID:    t.UserID,
+		FirstName: t.FirstName,
+		LastName:  t.LastName,
+		ExpiresAt: t.SessionExpiresAt,
+	}
+}
+
+// issueAccessToken creates a signed token for a session.
+// The token expires after ACCESS_TOKEN_TTL, or with the session if that is earlier.
+// Returns the token and its expiry.
+func issueAccessToken(s Session) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ACCESS_TOKEN_TTL).Unix()
+	if expiresAt > s.ExpiresAt {
+		expiresAt = s.ExpiresAt
+	}
+	token, err := encodeSigned(s.AppID, accessTokenKeyPurpose, accessToken{
+		SessionID:        s.ID,
+		AppID:            s.AppID,
+		UserID:           s.UserID,
+		FirstName:        s.FirstName,
+		LastName:         s.LastName,
+		ExpiresAt:        expiresAt,
+		SessionExpiresAt: s.ExpiresAt,
+	})
+	return token, time.Unix(expiresAt, 0), err
+}
+
+// parseAccessToken verifies the signature and expiry of a token and returns it
+// together with the configuration of its app.
+func parseAccessToken(value string) (accessToken, *AppConfig, error) {
+	var t accessToken
+	app, err := decodeSigned(accessTokenKeyPurpose, value, &t)
+	if errors.Is(err, errUnknownSessionApp) {
+		return accessToken{}, nil, err
+	}
+	if err != nil || t.UserID <= 0 || t.SessionID == "" {
+		return accessToken{}, nil, errBadToken
+	}
+	if time.Now().Unix() >= t.ExpiresAt {
+		return accessToken{}, nil, errExpiredToken
+	}
+	return t, app, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", errNoToken
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// RequireAccessToken wraps an API handler so it only runs for requests with a
+// valid bearer token. Like RequireTonPlaceUser, it stores the verified user in
+// the request context (see UserFromContext and AuthFromContext).
+// Requests without a valid token are answered with 401 and a JSON error.
+func RequireAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, err := authenticateToken(r)
+		if err != nil {
+			log.Printf("Rejected API request: %v", err)
+			writeTokenError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withAuth(r.Context(), auth)))
+	})
+}
+
+// authenticateToken verifies the bearer token of a request.
+func authenticateToken(r *http.Request) (*Auth, error) {
+	value, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	t, app, err := parseAccessToken(value)
+	if err != nil {
+		return nil, err
+	}
+	s := t.session()
+	return &Auth{
+		User:        s.UserParams(),
+		UserID:      s.UserID,
+		App:         app,
+		Session:     s,
+		FromSession: true,
+	}, nil
+}
+
+// handleRefreshToken exchanges a valid access token for a new one with a fresh expiry.
+// Route: POST /api/refresh-token (wrapped in RequireAccessToken)
+func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	auth, _ := AuthFromContext(r.Context())
+	token, expiresAt, err := issueAccessToken(auth.Session)
+	if err != nil {
+		log.Printf("Failed to issue access token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to refresh token"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"expires_at":   expiresAt.Unix(),
+	})
+}
+
+// writeTokenError answers an API request without a valid access token.
+func writeTokenError(w http.ResponseWriter, err error) {
+	msg := "Not authorized. Please reopen the app from Ton.Place."
+	if errors.Is(err, errExpiredToken) {
+		msg = "Access token expired. Please reopen the app from Ton.Place."
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tonplace-demo"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
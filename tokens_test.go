@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenApps registers the app used by the access token tests.
+func tokenApps(t *testing.T) {
+	withApps(t, &AppConfig{ID: "1", Secrets: []AppSecret{{ID: "current", Secret: "s"}}})
+}
+
+// testSession returns a session of user 42 in app 1 that ends after d.
+func testSession(d time.Duration) Session {
+	return Session{ID: "sid", AppID: "1", UserID: 42, FirstName: "Ada", ExpiresAt: time.Now().Add(d).Unix()}
+}
+
+func TestRequireAccessToken(t *testing.T) {
+	tokenApps(t)
+	session := testSession(time.Hour)
+
+	valid, _, err := issueAccessToken(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := encodeSigned("1", accessTokenKeyPurpose, accessToken{
+		SessionID: "sid", AppID: "1", UserID: 42,
+		ExpiresAt:        time.Now().Add(-time.Second).Unix(),
+		SessionExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie, err := encodeSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		wantCode  int
+		wantError string
+	}{
+		{"valid", "Bearer " + valid, http.StatusOK, ""},
+		{"lowercase scheme", "bearer " + valid, http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, "Not authorized"},
+		{"other scheme", "Basic " + valid, http.StatusUnauthorized, "Not authorized"},
+		{"empty token", "Bearer ", http.StatusUnauthorized, "Not authorized"},
+		{"malformed", "Bearer not-a-token", http.StatusUnauthorized, "Not authorized"},
+		{"tampered", "Bearer " + strings.Replace(valid, valid[:8], "AAAAAAAA", 1), http.StatusUnauthorized, "Not authorized"},
+		{"session cookie", "Bearer " + cookie, http.StatusUnauthorized, "Not authorized"},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized, "expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Auth
+			handler := RequireAccessToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = AuthFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/transactions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK {
+				if got == nil || got.UserID != 42 || got.App.ID != "1" || got.Session != session || !got.FromSession {
+					t.Errorf("auth = %+v, want the token's session", got)
+				}
+				return
+			}
+
+			if got != nil {
+				t.Error("handler ran for a rejected token")
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || !strings.Contains(body["error"], tt.wantError) {
+				t.Errorf("body = %s, want error containing %q", rec.Body, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	tokenApps(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		session    time.Duration // Remaining session lifetime
+		wantCode   int
+		wantExpiry time.Duration // Expected lifetime of the new token
+	}{
+		{"extends by the token TTL", http.MethodPost, time.Hour, http.StatusOK, ACCESS_TOKEN_TTL},
+		{"never past the session", http.MethodPost, 5 * time.Minute, http.StatusOK, 5 * time.Minute},
+		{"GET not allowed", http.MethodGet, time.Hour, http.StatusMethodNotAllowed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := testSession(tt.session)
+			token, _, err := issueAccessToken(session)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, "/api/refresh-token", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			RequireAccessToken(http.HandlerFunc(handleRefreshToken)).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				AccessToken string `json:"access_token"`
+				ExpiresAt   int64  `json:"expires_at"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ExpiresAt > session.ExpiresAt {
+				t.Errorf("token expires at %d, after the session (%d)", resp.ExpiresAt, session.ExpiresAt)
+			}
+			want := time.Now().Add(tt.wantExpiry).Unix()
+			if d := resp.ExpiresAt - want; d < -2 || d > 2 {
+				t.Errorf("token expires at %d, want about %d", resp.ExpiresAt, want)
+			}
+
+			refreshed, _, err := parseAccessToken(resp.AccessToken)
+			if err != nil || refreshed.session() != session {
+				t.Errorf("refreshed token = %+v, %v; want session %+v", refreshed, err, session)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package tonplace
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ====================================================================================
+// CIRCUIT BREAKER
+// ====================================================================================
+// When Ton.Place is down, waiting for every request to time out makes each page
+// load slow. The circuit breaker counts consecutive upstream failures
+// (network errors and HTTP 5xx) and stops sending requests once a threshold is hit:
+//
+//   closed    - Normal operation, requests are sent
+//   open      - Requests fail immediately with ErrCircuitOpen until the cooldown passes
+//   half-open - A limited number of probe requests are let through; a success closes
+//               the circuit, a failure opens it again for another cooldown
+//
+// Client errors (4xx), rate limiting and caller cancellations don't count as failures.
+// ====================================================================================
+
+// ErrCircuitOpen - The request was not sent because the circuit breaker is open.
+// Errors returned for this reason also match ErrUpstreamUnavailable.
+var ErrCircuitOpen = errors.New("tonplace: circuit breaker open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed - Requests flow normally
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen - Requests are rejected without calling the API
+	BreakerOpen
+
+	// BreakerHalfOpen - Probe requests are allowed to test if the API recovered
+	BreakerHalfOpen
+)
+
+// String returns the state name: "closed", "open" or "half-open".
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerSettings configures a CircuitBreaker.
+// Zero fields are replaced by the values of DefaultBreakerSettings.
+type BreakerSettings struct {
+	// FailureThreshold - Consecutive failures that open the circuit
+	FailureThreshold int
+
+	// Cooldown - How long the circuit stays open before probing again
+	Cooldown time.Duration
+
+	// HalfOpenMaxRequests - Number of concurrent probe requests allowed in half-open state
+	HalfOpenMaxRequests int
+
+	// OnStateChange - Optional callback invoked after every state transition
+	// Called without holding the breaker lock; must not block for long
+	OnStateChange func(from, to BreakerState)
+}
+
+// DefaultBreakerSettings opens the circuit after 5 consecutive failures
+// and probes again after 30 seconds.
+var DefaultBreakerSettings = BreakerSettings{
+	FailureThreshold:    5,
+	Cooldown:            30 * time.Second,
+	HalfOpenMaxRequests: 1,
+}
+
+// CircuitBreaker protects callers from a failing upstream. It is safe for concurrent use.
+type CircuitBreaker struct {
+	settings BreakerSettings
+
+	mu sync.Mutex
+	// state - Current state
+	state BreakerState
+	// failures - Consecutive failures observed in closed state
+	failures int
+	// openedAt - When the circuit was last opened
+	openedAt time.Time
+	// probes - Probe requests currently in flight in half-open state
+	probes int
+	// generation - Incremented on every state change, so results of requests
+	// allowed in an earlier state are ignored
+	generation uint64
+}
+
+// breakerTicket is handed out by allow and passed back to record.
+type breakerTicket struct {
+	// generation - Breaker generation the request was allowed in
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed circuit breaker.
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultBreakerSettings.FailureThreshold
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = DefaultBreakerSettings.Cooldown
+	}
+	if settings.HalfOpenMaxRequests <= 0 {
+		settings.HalfOpenMaxRequests = DefaultBreakerSettings.HalfOpenMaxRequests
+	}
+	return &CircuitBreaker{settings: settings}
+}
+
+// WithCircuitBreaker guards all requests of the client with breaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(c *Client) {
+		c.breaker = breaker
+	}
+}
+
+// BreakerState returns the state of the client's circuit breaker.
+// A client without a breaker always reports BreakerClosed.
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
+// State returns the current state. An open circuit whose cooldown has passed
+// is reported as half-open.
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.settings.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a request may be sent now.
+// Every successful allow must be followed by exactly one call to record with
+// the returned ticket.
+func (b *CircuitBreaker) allow() (breakerTicket, error) {
+	if b == nil {
+		return breakerTicket{}, nil
+	}
+	b.mu.Lock()
+
+	// Cooldown passed - start probing
+	var from BreakerState
+	changed := false
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.settings.Cooldown {
+		from, changed = b.state, true
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.generation++
+	}
+
+	var err error
+	switch b.state {
+	case BreakerOpen:
+		retryIn := b.settings.Cooldown - time.Since(b.openedAt)
+		err = fmt.Errorf("%w (retry in %s): %w", ErrCircuitOpen, retryIn.Round(time.Second), ErrUpstreamUnavailable)
+	case BreakerHalfOpen:
+		if b.probes >= b.settings.HalfOpenMaxRequests {
+			err = fmt.Errorf("%w (probe in progress): %w", ErrCircuitOpen, ErrUpstreamUnavailable)
+		} else {
+			b.probes++
+		}
+	}
+	ticket := breakerTicket{generation: b.generation}
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(from, BreakerHalfOpen)
+	}
+	return ticket, err
+}
+
+// record reports the outcome of a request that was allowed.
+// Pass the ticket returned by allow and the error of the attempt (nil on success).
+// Results of requests allowed before the last state change are ignored: a slow
+// request started while the circuit was closed must neither count as a probe nor
+// decide the outcome of half-open state.
+func (b *CircuitBreaker) record(ticket breakerTicket, err error) {
+	if b == nil {
+		return
+	}
+	failed := isBreakerFailure(err)
+	healthy := isBreakerSuccess(err)
+
+	b.mu.Lock()
+	if ticket.generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+	from := b.state
+	switch b.state {
+	case BreakerClosed:
+		if healthy {
+			b.failures = 0
+		} else if failed {
+			if b.failures++; b.failures >= b.settings.FailureThreshold {
+				b.trip()
+			}
+		}
+	case BreakerHalfOpen:
+		b.probes--
+		if failed {
+			b.trip()
+		} else if healthy {
+			b.state = BreakerClosed
+			b.failures = 0
+			b.generation++
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// trip opens the circuit. Caller must hold b.mu.
+func (b *CircuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+	b.probes = 0
+	b.generation++
+}
+
+// notify invokes the OnStateChange callback, if any.
+func (b *CircuitBreaker) notify(from, to BreakerState) {
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(from, to)
+	}
+}
+
+// isBreakerFailure reports whether err indicates that the upstream is unhealthy.
+func isBreakerFailure(err error) bool {
+	return err != nil && errors.Is(err, ErrUpstreamUnavailable) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// isBreakerSuccess reports whether the upstream answered, even if with an error
+// such as HTTP 400. Errors that say nothing about upstream health (cancellation,
+// client-side rate limiting) are neither a success nor a failure.
+func isBreakerSuccess(err error) bool {
+	if err == nil {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !isBreakerFailure(err)
+}
@@ -0,0 +1,53 @@
+package tonplace
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBreakerIgnoresRequestsFromEarlierStates(t *testing.T) {
+	b := NewCircuitBreaker(BreakerSettings{FailureThreshold: 1, Cooldown: 10 * time.Millisecond, HalfOpenMaxRequests: 1})
+	upstreamDown := fmt.Errorf("%w: connection refused", ErrUpstreamUnavailable)
+
+	// A slow request starts while the circuit is closed
+	slow, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another request fails and opens the circuit
+	fast, _ := b.allow()
+	b.record(fast, upstreamDown)
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("state = %s, want open", s)
+	}
+
+	// After the cooldown one probe is let through
+	time.Sleep(15 * time.Millisecond)
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+
+	// The slow request finishes during half-open: it is not a probe
+	b.record(slow, upstreamDown)
+	if s := b.State(); s != BreakerHalfOpen {
+		t.Fatalf("state after the slow request = %s, want half-open", s)
+	}
+	if _, err := b.allow(); err == nil {
+		t.Fatal("a second probe was allowed while the first is in flight")
+	}
+
+	// The probe decides
+	b.record(probe, nil)
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("state after the probe = %s, want closed", s)
+	}
+
+	// A stale probe result can't reopen the closed circuit
+	b.record(probe, upstreamDown)
+	if s := b.State(); s != BreakerClosed {
+		t.Errorf("state after a stale result = %s, want closed", s)
+	}
+}
@@ -0,0 +1,87 @@
+package tonplace_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var transitions []string
+	breaker := tonplace.NewCircuitBreaker(tonplace.BreakerSettings{
+		FailureThreshold: 2,
+		Cooldown:         cooldown,
+		OnStateChange: func(from, to tonplace.BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	client := srv.APIClient(tonplace.WithCircuitBreaker(breaker))
+	list := func() error {
+		_, err := client.ListPurchases(context.Background(), tonplace.ListPurchasesOptions{})
+		return err
+	}
+
+	steps := []struct {
+		name         string
+		failure      *tonplacetest.Failure
+		wait         time.Duration
+		wantErr      error
+		wantState    tonplace.BreakerState
+		wantRequests int // Requests reaching the server in this step
+	}{
+		{"success keeps it closed", nil, 0, nil, tonplace.BreakerClosed, 1},
+		{"4xx is not a failure", &tonplacetest.Failure{StatusCode: 400}, 0, tonplace.ErrInvalidRequest, tonplace.BreakerClosed, 1},
+		{"first failure", &tonplacetest.Failure{StatusCode: 500}, 0, tonplace.ErrUpstreamUnavailable, tonplace.BreakerClosed, 1},
+		{"threshold opens it", &tonplacetest.Failure{StatusCode: 500}, 0, tonplace.ErrUpstreamUnavailable, tonplace.BreakerOpen, 1},
+		{"open rejects without a request", nil, 0, tonplace.ErrCircuitOpen, tonplace.BreakerOpen, 0},
+		{"failed probe opens it again", &tonplacetest.Failure{StatusCode: 503}, cooldown, tonplace.ErrUpstreamUnavailable, tonplace.BreakerOpen, 1},
+		{"successful probe closes it", nil, cooldown, nil, tonplace.BreakerClosed, 1},
+	}
+
+	for _, step := range steps {
+		if step.failure != nil {
+			srv.Fail(*step.failure)
+		}
+		time.Sleep(step.wait)
+
+		before := srv.Requests()
+		err := list()
+		if step.wantErr == nil && err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if got := client.BreakerState(); got != step.wantState {
+			t.Fatalf("%s: state = %v, want %v", step.name, got, step.wantState)
+		}
+		if n := srv.Requests() - before; n != step.wantRequests {
+			t.Errorf("%s: made %d requests, want %d", step.name, n, step.wantRequests)
+		}
+	}
+
+	want := []string{
+		"closed->open",
+		"open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+}
@@ -0,0 +1,215 @@
+// ====================================================================================
+// TON.PLACE API CLIENT
+// ====================================================================================
+// Package tonplace is a small client for the Ton.Place Public API.
+//
+// It wraps the endpoints used by mini apps:
+//   - GET  /apps/purchases        - list purchases made in your app
+//   - POST /apps/purchase/create  - create a new purchase (payment request)
+//
+// Usage:
+//
+//	client := tonplace.NewClient(appID, secret)
+//	purchases, err := client.ListPurchases(ctx, tonplace.ListPurchasesOptions{UserID: userID})
+//
+// Every API method takes a context.Context. Pass the incoming request's context
+// (r.Context()) so cancellation and deadlines propagate to Ton.Place calls.
+//
+// API Base URL: https://api.tonplace.net
+// ====================================================================================
+
+package tonplace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL - Base URL of the production Ton.Place API
+const DefaultBaseURL = "https://api.tonplace.net"
+
+// defaultTimeout - Timeout of the HTTP client created when none is supplied
+const defaultTimeout = 10 * time.Second
+
+// Client talks to the Ton.Place Public API on behalf of a single app.
+// A Client is safe for concurrent use by multiple goroutines.
+type Client struct {
+	// appID - Your application ID, sent as App-Id header
+	appID string
+
+	// secret - Your application secret, sent as Secret header
+	// NEVER expose this on the client side or in public repositories
+	secret string
+
+	// baseURL - API endpoint, without trailing slash
+	baseURL string
+
+	// httpClient - Underlying HTTP client used for all requests
+	httpClient *http.Client
+
+	// retry - Policy for retrying transient failures
+	retry RetryPolicy
+
+	// limiter - Optional client-side rate limiter (nil = unlimited)
+	limiter *RateLimiter
+
+	// breaker - Optional circuit breaker (nil = disabled)
+	breaker *CircuitBreaker
+
+	// interceptors - Middleware applied to every HTTP attempt, outermost first
+	interceptors []Interceptor
+
+	// transport - httpClient wrapped in the interceptor chain
+	transport http.RoundTripper
+}
+
+// Option configures optional Client settings in NewClient.
+type Option func(*Client)
+
+// WithBaseURL overrides the API base URL (e.g. to point at a staging or fake server).
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests.
+// Use it to share connection pools, set timeouts or install custom transports.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a client authenticated with the given app credentials.
+// By default it uses DefaultBaseURL, DefaultRetryPolicy and an HTTP client
+// with a 10 second timeout.
+func NewClient(appID, secret string, opts ...Option) *Client {
+	c := &Client{
+		appID:   appID,
+		secret:  secret,
+		baseURL: DefaultBaseURL,
+		retry:   DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	c.baseURL = strings.TrimRight(c.baseURL, "/")
+	c.transport = c.buildTransport()
+	return c
+}
+
+// AppID returns the application ID this client authenticates as.
+func (c *Client) AppID() string {
+	return c.appID
+}
+
+// do sends a request to the API and decodes a successful JSON response into out.
+// Authentication headers are added to every request.
+// Non-200 responses are returned as *APIError.
+//
+// The request is bound to ctx: cancelling it (e.g. when the user closes the mini app)
+// aborts the outgoing call. Transient failures are retried according to the
+// client's RetryPolicy.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	for attempt := 1; ; attempt++ {
+		// Fail fast while Ton.Place is known to be down
+		ticket, err := c.breaker.allow()
+		if err != nil {
+			return err
+		}
+
+		// Every attempt counts against the client-side rate limit
+		if err := c.limiter.Wait(ctx); err != nil {
+			c.breaker.record(ticket, err)
+			return err
+		}
+
+		err = c.send(ctx, method, path, body, out)
+		c.breaker.record(ticket, err)
+		if err == nil {
+			return nil
+		}
+
+		// Give up if attempts are exhausted or the request is not safe to repeat
+		if attempt >= c.retry.MaxAttempts || !isRetryable(method, err) {
+			return err
+		}
+
+		// Wait before the next attempt, honoring Retry-After if the API sent one
+		delay := c.retry.backoff(attempt)
+		if hint := retryAfter(err); hint > delay {
+			// Callers without a deadline (e.g. page loads) must not hang for minutes
+			if c.retry.MaxRetryAfter > 0 && hint > c.retry.MaxRetryAfter {
+				return err
+			}
+			delay = hint
+		}
+		// Don't start waiting if the caller's deadline would pass first
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		if sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// send performs a single attempt of an API request.
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	// Create HTTP request
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set required authentication headers
+	// These headers authenticate your app with Ton.Place API
+	req.Header.Set("App-Id", c.appID)  // Your app ID
+	req.Header.Set("Secret", c.secret) // Your app secret (keep it private!)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute request
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		// Cancellation by the caller is not an upstream failure
+		if ctx.Err() != nil {
+			return fmt.Errorf("request failed: %w", ctx.Err())
+		}
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read response: %w", ErrUpstreamUnavailable, err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		apiPath, _, _ := strings.Cut(path, "?")
+		apiErr := newAPIError(method, apiPath, resp.StatusCode, respBody)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return apiErr
+	}
+
+	// Parse JSON response
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
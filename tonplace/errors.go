@@ -0,0 +1,174 @@
+package tonplace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ====================================================================================
+// ERRORS
+// ====================================================================================
+// Every non-200 response from the API is returned as *APIError.
+// Use errors.Is with the sentinel errors below to branch on the kind of failure,
+// and errors.As to get the details:
+//
+//	var apiErr *tonplace.APIError
+//	if errors.As(err, &apiErr) {
+//	    log.Printf("Ton.Place %s failed: %d %s", apiErr.Path, apiErr.StatusCode, apiErr.Code)
+//	}
+//	if errors.Is(err, tonplace.ErrRateLimited) {
+//	    // back off and try again later
+//	}
+// ====================================================================================
+
+var (
+	// ErrUnauthorized - App-Id/Secret were rejected (HTTP 401 or 403)
+	ErrUnauthorized = errors.New("tonplace: unauthorized")
+
+	// ErrRateLimited - Too many requests (HTTP 429)
+	ErrRateLimited = errors.New("tonplace: rate limited")
+
+	// ErrInvalidRequest - The API rejected the request parameters (HTTP 400, 404, 422)
+	ErrInvalidRequest = errors.New("tonplace: invalid request")
+
+	// ErrUpstreamUnavailable - Ton.Place could not be reached or failed (network error, HTTP 5xx)
+	ErrUpstreamUnavailable = errors.New("tonplace: upstream unavailable")
+)
+
+// maxErrorMessageLen - Longest raw response body kept as error message
+// when the body is not a JSON error object
+const maxErrorMessageLen = 200
+
+// APIError describes a non-200 response from the Ton.Place API.
+type APIError struct {
+	// StatusCode - HTTP status code returned by the API
+	StatusCode int
+
+	// Code - Machine-readable error code from the response body (may be empty)
+	Code string
+
+	// Message - Human-readable error message from the response body (may be empty)
+	Message string
+
+	// Method - HTTP method of the failed request
+	Method string
+
+	// Path - API path of the failed request, without query string (e.g. "/apps/purchases")
+	Path string
+
+	// RetryAfter - Delay requested by the API's Retry-After header (0 if not sent)
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("tonplace: %s %s: status %d", e.Method, e.Path, e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is reports whether the error matches one of the sentinel errors,
+// based on the HTTP status code.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrInvalidRequest:
+		return e.StatusCode == http.StatusBadRequest ||
+			e.StatusCode == http.StatusNotFound ||
+			e.StatusCode == http.StatusUnprocessableEntity
+	case ErrUpstreamUnavailable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a failed response.
+// The body is parsed for common error fields; the raw body is never exposed as-is
+// beyond a short, trimmed message.
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		Path:       path,
+	}
+
+	// Known error body shapes:
+	//   {"error": "message"}
+	//   {"error": {"code": "...", "message": "..."}}
+	//   {"code": "...", "message": "..."}
+	var parsed struct {
+		Error       json.RawMessage `json:"error"`
+		Code        json.RawMessage `json:"code"`
+		Message     string          `json:"message"`
+		Description string          `json:"description"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		apiErr.Message = truncate(strings.TrimSpace(string(body)), maxErrorMessageLen)
+		return apiErr
+	}
+
+	apiErr.Code = rawString(parsed.Code)
+	apiErr.Message = parsed.Message
+	if apiErr.Message == "" {
+		apiErr.Message = parsed.Description
+	}
+
+	if len(parsed.Error) > 0 {
+		var nested struct {
+			Code    json.RawMessage `json:"code"`
+			Message string          `json:"message"`
+		}
+		if s := rawString(parsed.Error); s != "" {
+			if apiErr.Message == "" {
+				apiErr.Message = s
+			}
+		} else if json.Unmarshal(parsed.Error, &nested) == nil {
+			if apiErr.Code == "" {
+				apiErr.Code = rawString(nested.Code)
+			}
+			if apiErr.Message == "" {
+				apiErr.Message = nested.Message
+			}
+		}
+	}
+
+	apiErr.Message = truncate(apiErr.Message, maxErrorMessageLen)
+	return apiErr
+}
+
+// rawString converts a JSON string or number to its string form.
+// Returns empty string for any other JSON value.
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// truncate shortens s to at most n bytes, marking the cut with "...".
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
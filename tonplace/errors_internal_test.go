@@ -0,0 +1,73 @@
+package tonplace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIErrorBody(t *testing.T) {
+	long := strings.Repeat("x", 300)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    string
+		wantMessage string
+	}{
+		{"error string", `{"error": "title too long"}`, "", "title too long"},
+		{"nested error", `{"error": {"code": "invalid_title", "message": "title too long"}}`, "invalid_title", "title too long"},
+		{"nested numeric code", `{"error": {"code": 1003, "message": "title too long"}}`, "1003", "title too long"},
+		{"flat code and message", `{"code": "invalid_title", "message": "title too long"}`, "invalid_title", "title too long"},
+		{"description", `{"code": 42, "description": "title too long"}`, "42", "title too long"},
+		{"empty JSON object", `{}`, "", ""},
+		{"plain text", "  Bad Gateway\n", "", "Bad Gateway"},
+		{"HTML", "<html><body>502</body></html>", "", "<html><body>502</body></html>"},
+		{"long plain text is cut", long, "", long[:maxErrorMessageLen] + "..."},
+		{"long JSON message is cut", `{"message": "` + long + `"}`, "", long[:maxErrorMessageLen] + "..."},
+		{"empty body", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAPIError("POST", "/apps/purchase/create", 400, []byte(tt.body))
+			if err.Code != tt.wantCode || err.Message != tt.wantMessage {
+				t.Errorf("code=%q message=%q, want %q and %q", err.Code, err.Message, tt.wantCode, tt.wantMessage)
+			}
+			if err.StatusCode != 400 || err.Method != "POST" || err.Path != "/apps/purchase/create" {
+				t.Errorf("request details lost: %+v", err)
+			}
+		})
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	sentinels := []error{ErrUnauthorized, ErrRateLimited, ErrInvalidRequest, ErrUpstreamUnavailable}
+
+	tests := []struct {
+		status int
+		want   error // nil = matches no sentinel
+	}{
+		{400, ErrInvalidRequest},
+		{401, ErrUnauthorized},
+		{403, ErrUnauthorized},
+		{404, ErrInvalidRequest},
+		{409, nil},
+		{422, ErrInvalidRequest},
+		{429, ErrRateLimited},
+		{500, ErrUpstreamUnavailable},
+		{502, ErrUpstreamUnavailable},
+		{503, ErrUpstreamUnavailable},
+	}
+
+	for _, tt := range tests {
+		// Wrapped like the client returns it
+		err := fmt.Errorf("list purchases: %w", newAPIError("GET", "/apps/purchases", tt.status, nil))
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+				t.Errorf("status %d: errors.Is(%v) = %v", tt.status, sentinel, got)
+			}
+		}
+	}
+}
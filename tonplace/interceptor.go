@@ -0,0 +1,174 @@
+package tonplace
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ====================================================================================
+// INTERCEPTORS
+// ====================================================================================
+// Interceptors wrap every HTTP attempt made by the client. Use them to add logging,
+// tracing, metrics or custom headers without changing the client itself:
+//
+//	client := tonplace.NewClient(appID, secret, tonplace.WithInterceptors(
+//	    tonplace.LoggingInterceptor(nil, 512),
+//	    func(next http.RoundTripper) http.RoundTripper {
+//	        return tonplace.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+//	            req = req.Clone(req.Context())
+//	            req.Header.Set("X-Request-Id", requestID(req.Context()))
+//	            return next.RoundTrip(req)
+//	        })
+//	    },
+//	))
+//
+// The first interceptor is the outermost one: it sees the request first and the
+// response last. Interceptors run once per attempt, so retries are visible to them.
+// Like any http.RoundTripper, an interceptor must not modify the request it is
+// given - clone it first.
+// ====================================================================================
+
+// Interceptor wraps the next RoundTripper in the chain.
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper interface.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithInterceptors appends interceptors to the client's chain.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// buildTransport wraps the HTTP client in the interceptor chain.
+func (c *Client) buildTransport() http.RoundTripper {
+	var rt http.RoundTripper = RoundTripperFunc(c.httpClient.Do)
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		rt = c.interceptors[i](rt)
+	}
+	return rt
+}
+
+// ====================================================================================
+// LOGGING INTERCEPTOR
+// ====================================================================================
+
+// redactedHeaders - Headers whose values never appear in logs
+var redactedHeaders = []string{"Secret", "Authorization", "Cookie", "Set-Cookie"}
+
+// LoggingInterceptor logs every request and response: method, URL, headers, status,
+// duration and bodies truncated to maxBody bytes (0 = don't log bodies).
+// The Secret header (and other credentials) are always replaced by "[REDACTED]".
+// A nil logger logs to log.Default().
+func LoggingInterceptor(logger *log.Logger, maxBody int) Interceptor {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// Log request
+			reqBody, err := peekRequestBody(req, maxBody)
+			if err != nil {
+				return nil, err
+			}
+			logger.Printf("tonplace -> %s %s headers=%s body=%s",
+				req.Method, req.URL.Redacted(), formatHeaders(req.Header), reqBody)
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logger.Printf("tonplace <- %s %s error=%v (%s)", req.Method, req.URL.Path, err, elapsed)
+				return nil, err
+			}
+
+			// Log response
+			respBody, err := peekResponseBody(resp, maxBody)
+			if err != nil {
+				return nil, err
+			}
+			logger.Printf("tonplace <- %s %s status=%d headers=%s body=%s (%s)",
+				req.Method, req.URL.Path, resp.StatusCode, formatHeaders(resp.Header), respBody, elapsed)
+			return resp, nil
+		})
+	}
+}
+
+// formatHeaders renders headers for logging with credentials redacted.
+func formatHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ",")
+		for _, redacted := range redactedHeaders {
+			if strings.EqualFold(name, redacted) {
+				value = "[REDACTED]"
+			}
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
+
+// peekRequestBody returns the (truncated) request body and leaves the request
+// body readable for the next RoundTripper.
+func peekRequestBody(req *http.Request, maxBody int) (string, error) {
+	if maxBody <= 0 || req.Body == nil || req.Body == http.NoBody {
+		return "-", nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		return readTruncated(body, maxBody)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return truncate(string(data), maxBody), nil
+}
+
+// peekResponseBody returns the (truncated) response body and replaces the
+// response body with a buffered copy so the caller can still read it.
+func peekResponseBody(resp *http.Response, maxBody int) (string, error) {
+	if maxBody <= 0 || resp.Body == nil {
+		return "-", nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return truncate(string(data), maxBody), nil
+}
+
+// readTruncated reads up to maxBody bytes of r, marking cut-off content with "...".
+func readTruncated(r io.Reader, maxBody int) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxBody)+1))
+	if err != nil {
+		return "", err
+	}
+	return truncate(string(data), maxBody), nil
+}
@@ -0,0 +1,111 @@
+package tonplace_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tonplace_app_demo/tonplace"
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	const secret = "very-secret-value"
+	reqBody := `{"user_id":7,"amount":100,"title":"` + strings.Repeat("x", 100) + `"}`
+	respBody := `{"purchase_id":1,"padding":"` + strings.Repeat("y", 100) + `"}`
+
+	tests := []struct {
+		name      string
+		maxBody   int
+		header    string // Credential header sent with the request
+		noGetBody bool   // Request body can only be read once
+	}{
+		{"bodies cut at maxBody", 16, "Secret", false},
+		{"body without GetBody", 16, "Secret", true},
+		{"bodies not logged", 0, "Secret", false},
+		{"authorization header", 16, "Authorization", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			var gotReqBody string
+			next := tonplace.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				data, _ := io.ReadAll(req.Body)
+				gotReqBody = string(data)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Set-Cookie": {"session=" + secret}},
+					Body:       io.NopCloser(strings.NewReader(respBody)),
+					Request:    req,
+				}, nil
+			})
+			rt := tonplace.LoggingInterceptor(log.New(&logs, "", 0), tt.maxBody)(next)
+
+			req, _ := http.NewRequest(http.MethodPost, "https://api.example/apps/purchase/create", strings.NewReader(reqBody))
+			req.Header.Set(tt.header, secret)
+			if tt.noGetBody {
+				req.GetBody = nil
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+
+			// Downstream and caller see the whole bodies
+			if gotReqBody != reqBody {
+				t.Errorf("next got request body %q, want %q", gotReqBody, reqBody)
+			}
+			if string(data) != respBody {
+				t.Errorf("caller got response body %q, want %q", data, respBody)
+			}
+
+			out := logs.String()
+			if strings.Contains(out, secret) {
+				t.Errorf("secret leaked into the log:\n%s", out)
+			}
+			if !strings.Contains(out, tt.header+": [REDACTED]") || !strings.Contains(out, "Set-Cookie: [REDACTED]") {
+				t.Errorf("credentials not marked as redacted:\n%s", out)
+			}
+			if tt.maxBody == 0 {
+				if strings.Contains(out, "user_id") || strings.Contains(out, "purchase_id") {
+					t.Errorf("bodies logged with maxBody 0:\n%s", out)
+				}
+				return
+			}
+			for _, body := range []string{reqBody, respBody} {
+				if !strings.Contains(out, "body="+body[:tt.maxBody]+"...") || strings.Contains(out, body[:tt.maxBody+1]) {
+					t.Errorf("body not cut at %d bytes:\n%s", tt.maxBody, out)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggingInterceptorWithClient(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "very-secret-value")
+	defer srv.Close()
+	for i := 0; i < 5; i++ {
+		srv.AddPurchase(tonplace.Transaction{UserID: 7, Amount: 100})
+	}
+
+	var logs bytes.Buffer
+	client := srv.APIClient(tonplace.WithInterceptors(tonplace.LoggingInterceptor(log.New(&logs, "", 0), 8)))
+
+	// The response is much longer than maxBody, but the client still decodes all of it
+	txs, err := client.ListPurchases(context.Background(), tonplace.ListPurchasesOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 5 {
+		t.Errorf("got %d transactions, want 5", len(txs))
+	}
+	if strings.Contains(logs.String(), srv.Secret) {
+		t.Errorf("secret leaked into the log:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,91 @@
+package tonplace
+
+import (
+	"context"
+	"iter"
+)
+
+// ====================================================================================
+// PAGINATION
+// ====================================================================================
+// GET /apps/purchases returns at most 100 transactions per call. Older records are
+// fetched by passing the ID of the last transaction received as "last_id".
+//
+// AllPurchases hides this cursor handling behind a Go iterator:
+//
+//	opts := tonplace.ListPurchasesOptions{UserID: userID}
+//	for tx, err := range client.AllPurchases(ctx, opts, 0) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(tx.ID, tx.Status)
+//	}
+// ====================================================================================
+
+// MaxPageSize - Maximum number of transactions the API returns per request
+const MaxPageSize = 100
+
+// AllPurchases iterates over all purchases matching opts, requesting pages of
+// opts.Count transactions (MaxPageSize if unset) and following the last_id cursor
+// until no more are returned. A non-zero opts.LastID resumes from that cursor.
+//
+// A limit greater than 0 stops the iteration after that many transactions.
+// The iteration also stops when ctx is cancelled; the context error is then yielded
+// once. Any API error is yielded once and ends the iteration. Breaking out of the
+// loop stops further requests.
+func (c *Client) AllPurchases(ctx context.Context, opts ListPurchasesOptions, limit int) iter.Seq2[Transaction, error] {
+	return func(yield func(Transaction, error) bool) {
+		if err := opts.Validate(); err != nil {
+			yield(Transaction{}, err)
+			return
+		}
+
+		pageSize := opts.Count
+		if pageSize == 0 {
+			pageSize = MaxPageSize
+		}
+		yielded := 0
+
+		for {
+			// Stop early if the caller gave up
+			if err := ctx.Err(); err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+
+			// Don't request more than we are going to return
+			opts.Count = pageSize
+			if limit > 0 && limit-yielded < opts.Count {
+				opts.Count = limit - yielded
+			}
+
+			page, err := c.ListPurchases(ctx, opts)
+			if err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+
+			for _, tx := range page {
+				if !yield(tx, nil) {
+					return
+				}
+				yielded++
+				if limit > 0 && yielded >= limit {
+					return
+				}
+			}
+
+			// A short page means there is nothing left
+			if len(page) < opts.Count {
+				return
+			}
+
+			// Guard against a cursor that does not move forward
+			next := page[len(page)-1].ID
+			if next == opts.LastID {
+				return
+			}
+			opts.LastID = next
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tonplace_test
+
+import (
+	"context"
+	"testing"
+
+	"tonplace_app_demo/tonplace"
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+func TestAllPurchases(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+	for i := 0; i < 250; i++ {
+		status := tonplace.StatusPending
+		if i%2 == 0 {
+			status = tonplace.StatusPaid
+		}
+		srv.AddPurchase(tonplace.Transaction{UserID: 7, Amount: 100, Title: "Coins", Status: status})
+	}
+	client := srv.APIClient()
+
+	tests := []struct {
+		name         string
+		opts         tonplace.ListPurchasesOptions
+		limit        int
+		wantCount    int
+		wantRequests int
+	}{
+		{"all pages", tonplace.ListPurchasesOptions{}, 0, 250, 3}, // 100 + 100 + 50, the short page ends it
+		{"limit within first page", tonplace.ListPurchasesOptions{}, 10, 10, 1},
+		{"limit across pages", tonplace.ListPurchasesOptions{}, 150, 150, 2},
+		{"limit on page boundary", tonplace.ListPurchasesOptions{Count: 50}, 100, 100, 2},
+		{"status filter", tonplace.ListPurchasesOptions{Status: tonplace.StatusPaid}, 0, 125, 2},
+		{"resume from cursor", tonplace.ListPurchasesOptions{LastID: 11}, 0, 10, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := srv.Requests()
+			var lastID int64
+			count := 0
+			for tx, err := range client.AllPurchases(context.Background(), tt.opts, tt.limit) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if lastID != 0 && tx.ID >= lastID {
+					t.Fatalf("transaction %d after %d: not newest first", tx.ID, lastID)
+				}
+				lastID = tx.ID
+				count++
+			}
+			if count != tt.wantCount {
+				t.Errorf("got %d transactions, want %d", count, tt.wantCount)
+			}
+			if n := srv.Requests() - before; n != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestAllPurchasesStopsOnError(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+	srv.AddPurchase(tonplace.Transaction{UserID: 7, Amount: 100, Title: "Coins"})
+	srv.Fail(tonplacetest.Failure{StatusCode: 500})
+
+	errs := 0
+	for _, err := range srv.APIClient().AllPurchases(context.Background(), tonplace.ListPurchasesOptions{}, 0) {
+		if err == nil {
+			t.Fatal("got a transaction, want the API error")
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("got %d errors, want exactly 1", errs)
+	}
+}
@@ -0,0 +1,210 @@
+package tonplace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ====================================================================================
+// DATA STRUCTURES
+// ====================================================================================
+
+// Transaction represents a purchase record from Ton.Place API.
+// This is returned by GET /apps/purchases endpoint.
+type Transaction struct {
+	// ID - Unique identifier of the transaction
+	ID int64 `json:"id"`
+
+	// Amount - Purchase amount in smallest currency unit (cents for EUR, nanotons for TON)
+	// For EUR: 1 EUR = 100 (smallest unit)
+	// For TON: 1 TON = 1,000,000,000 (smallest unit)
+	Amount int64 `json:"amount"`
+
+	// Currency - Currency code: "eur" or "ton"
+	// Currently only "eur" is supported for purchases
+	Currency string `json:"currency"`
+
+	// UserID - ID of the user who made the purchase
+	UserID int64 `json:"user_id"`
+
+	// CreatedAt - Unix timestamp when purchase was created
+	CreatedAt int64 `json:"created_at"`
+
+	// Status - Purchase status: StatusPending or StatusPaid
+	// "pending" - payment initiated but not completed
+	// "paid" - payment successfully completed
+	Status string `json:"status"`
+
+	// Title - Purchase description/title (set when creating purchase)
+	Title string `json:"title"`
+}
+
+// Purchase statuses returned by the API and accepted as filter
+const (
+	// StatusPending - Payment initiated but not completed
+	StatusPending = "pending"
+
+	// StatusPaid - Payment successfully completed
+	StatusPaid = "paid"
+)
+
+// TransactionsResponse represents the API response for GET /apps/purchases
+type TransactionsResponse struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+// CreatePurchaseRequest represents the request body for creating a new purchase.
+// This is sent to POST /apps/purchase/create endpoint.
+type CreatePurchaseRequest struct {
+	// Amount - Purchase amount in smallest currency unit (required)
+	// For EUR: value in cents (e.g., 100 = 1.00 EUR)
+	// Must be greater than 0
+	Amount int64 `json:"amount"`
+
+	// Currency - Currency code (required)
+	// Currently only "eur" is supported
+	Currency string `json:"currency"`
+
+	// Title - Short description of what user is paying for (required)
+	// Maximum 150 characters
+	// Shown to user in payment dialog
+	Title string `json:"title"`
+
+	// UserID - ID of the user who should pay (required)
+	// Must match a valid Ton.Place user ID
+	UserID int64 `json:"user_id"`
+}
+
+// CreatePurchaseResponse represents the API response for POST /apps/purchase/create
+type CreatePurchaseResponse struct {
+	// PurchaseID - Unique identifier of the created purchase
+	// Use this ID with TonPlace.purchase() SDK method to initiate payment
+	PurchaseID int64 `json:"purchase_id"`
+}
+
+// ====================================================================================
+// PURCHASES API
+// ====================================================================================
+
+// ListPurchasesOptions holds the optional filters for GET /apps/purchases.
+// The zero value lists the newest purchases of all users of your app.
+type ListPurchasesOptions struct {
+	// UserID - Only return purchases of this user (0 = all users)
+	UserID int64
+
+	// Status - Only return purchases with this status: StatusPending or StatusPaid
+	// Empty string returns purchases with any status
+	Status string
+
+	// Count - Number of transactions to return (0 = API default of 20, max: MaxPageSize)
+	Count int
+
+	// LastID - Return transactions after this ID (pagination cursor, 0 = start from newest)
+	LastID int64
+}
+
+// Validate checks the options against the limits documented by the API.
+// Invalid options are reported as ErrInvalidRequest without calling the API.
+func (o ListPurchasesOptions) Validate() error {
+	if o.Count < 0 || o.Count > MaxPageSize {
+		return fmt.Errorf("%w: count must be between 0 and %d (0 = API default)", ErrInvalidRequest, MaxPageSize)
+	}
+	if o.Status != "" && o.Status != StatusPending && o.Status != StatusPaid {
+		return fmt.Errorf("%w: status must be %q or %q", ErrInvalidRequest, StatusPending, StatusPaid)
+	}
+	if o.UserID < 0 {
+		return fmt.Errorf("%w: user ID must not be negative", ErrInvalidRequest)
+	}
+	if o.LastID < 0 {
+		return fmt.Errorf("%w: last ID must not be negative", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// query encodes the options as URL query parameters, omitting unset fields.
+func (o ListPurchasesOptions) query() url.Values {
+	q := url.Values{}
+	if o.Count > 0 {
+		q.Set("count", strconv.Itoa(o.Count))
+	}
+	if o.LastID > 0 {
+		q.Set("last_id", strconv.FormatInt(o.LastID, 10))
+	}
+	if o.Status != "" {
+		q.Set("status", o.Status)
+	}
+	if o.UserID > 0 {
+		q.Set("userId", strconv.FormatInt(o.UserID, 10))
+	}
+	return q
+}
+
+// ListPurchases fetches one page of transactions (purchases) in your app.
+//
+// API Endpoint: GET /apps/purchases
+//
+// Query Parameters (all optional, see ListPurchasesOptions):
+//   - count: Number of transactions to return (default: 20, max: 100)
+//   - last_id: Last transaction ID for pagination (default: 0)
+//   - status: Filter by status - "pending" or "paid" (optional, returns all if not specified)
+//   - userId: Filter by user ID (optional)
+//
+// Returns: List of transactions or error
+//
+// Use AllPurchases to walk the full history instead of a single page.
+func (c *Client) ListPurchases(ctx context.Context, opts ListPurchasesOptions) ([]Transaction, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	path := "/apps/purchases"
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var result TransactionsResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Transactions, nil
+}
+
+// CreatePurchase creates a new purchase request that user can pay for.
+//
+// API Endpoint: POST /apps/purchase/create
+//
+// Request Body:
+//   - amount: Amount in smallest unit (cents for EUR) - required, must be > 0
+//   - currency: Currency code - required, must be "eur"
+//   - title: Purchase description - required, max 150 characters
+//   - user_id: User ID who will pay - required
+//
+// Returns: Purchase ID that you pass to TonPlace.purchase() SDK method
+//
+// Creating a purchase is not idempotent, so it is only retried when the API
+// certainly did not process it (HTTP 429 or a failed connection attempt).
+func (c *Client) CreatePurchase(ctx context.Context, userID int64, amount int64, title string) (int64, error) {
+	// Prepare request body
+	reqBody := CreatePurchaseRequest{
+		Amount:   amount,
+		Currency: "eur", // Currently only "eur" is supported
+		Title:    title,
+		UserID:   userID,
+	}
+
+	// Serialize to JSON
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var result CreatePurchaseResponse
+	if err := c.do(ctx, http.MethodPost, "/apps/purchase/create", jsonBody, &result); err != nil {
+		return 0, err
+	}
+	return result.PurchaseID, nil
+}
@@ -0,0 +1,130 @@
+package tonplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ====================================================================================
+// CLIENT-SIDE RATE LIMITING
+// ====================================================================================
+// A token bucket limits how fast the client sends requests to Ton.Place.
+// The bucket holds up to "burst" tokens and is refilled at "rate" tokens per second.
+// Every attempt (including retries) takes one token; when the bucket is empty
+// the call waits for the next token.
+//
+// A call never waits past its context deadline: if the next token would only
+// become available after the deadline, it fails immediately with ErrRateLimitWait.
+//
+// One RateLimiter can be shared by several clients to enforce a common budget:
+//
+//	limiter := tonplace.NewRateLimiter(10, 20) // 10 req/s, bursts of up to 20
+//	client := tonplace.NewClient(appID, secret, tonplace.WithRateLimiter(limiter))
+// ====================================================================================
+
+// ErrRateLimitWait - The client-side rate limiter could not grant a request
+// before the caller's context deadline. The request was not sent.
+var ErrRateLimitWait = errors.New("tonplace: rate limiter wait exceeds context deadline")
+
+// RateLimiter is a token bucket shared by all requests of one or more clients.
+// It is safe for concurrent use.
+type RateLimiter struct {
+	// rate - Tokens added per second
+	rate float64
+
+	// burst - Maximum number of tokens in the bucket
+	burst float64
+
+	mu sync.Mutex
+	// tokens - Tokens currently available (negative when waiters reserved future tokens)
+	tokens float64
+	// last - Time tokens were last refilled
+	last time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second on average,
+// with bursts of up to burst requests. The bucket starts full.
+// A burst below 1 is treated as 1. A rate of 0 or less disables limiting.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// WithRateLimiter makes the client wait for limiter before every request attempt.
+// Pass the same limiter to several clients to share one budget between them.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+// If ctx has a deadline that is earlier than the time the request would be allowed,
+// Wait returns ErrRateLimitWait immediately without consuming a token.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+
+	// Token available right away
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+
+	// Compute when our token will be available
+	wait := time.Duration(math.Ceil((1 - l.tokens) / l.rate * float64(time.Second)))
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < wait {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: would wait %s", ErrRateLimitWait, wait.Round(time.Millisecond))
+	}
+
+	// Reserve the future token so later callers queue up behind us
+	l.tokens--
+	l.mu.Unlock()
+
+	if err := sleep(ctx, wait); err != nil {
+		// Give the reserved token back, we are not going to use it
+		l.refund()
+		return err
+	}
+	return nil
+}
+
+// refund returns a reserved token that was not used.
+// The bucket never holds more than burst tokens, even after a long wait.
+func (l *RateLimiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
+
+// refill adds the tokens accumulated since the last refill. Caller must hold l.mu.
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens = math.Min(l.burst, l.tokens+elapsed*l.rate)
+	l.last = now
+}
@@ -0,0 +1,104 @@
+package tonplace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// available refills the bucket and returns the tokens currently in it.
+func (l *RateLimiter) available() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	return l.tokens
+}
+
+// near reports whether a and b differ by less than 0.1 tokens.
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.1
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(1, 3)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("burst of 3 took %s, want no wait", elapsed)
+	}
+
+	// The fourth request needs a new token, which takes a second
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, ErrRateLimitWait) {
+		t.Errorf("fourth request: err = %v, want %v", err, ErrRateLimitWait)
+	}
+}
+
+func TestRateLimiterDeadlineTooShort(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx); !errors.Is(err, ErrRateLimitWait) {
+		t.Fatalf("err = %v, want %v", err, ErrRateLimitWait)
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("returned after %s, want immediately", elapsed)
+	}
+	if got := l.available(); !near(got, 0) {
+		t.Errorf("tokens = %.2f, want 0 - a rejected request must not reserve a token", got)
+	}
+}
+
+func TestRateLimiterRefundOnCancel(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.Wait(context.Background())
+
+	// The caller gives up while queued for the next token
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := l.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if got := l.available(); !near(got, 0) {
+		t.Errorf("tokens = %.2f, want 0 - the reserved token must be given back", got)
+	}
+}
+
+func TestRateLimiterRefundCappedAtBurst(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens float64
+		since  time.Duration // Time since the last refill
+	}{
+		{"bucket full", 2, 0},
+		{"refilled during the wait", -1, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(10, 2)
+			l.mu.Lock()
+			l.tokens = tt.tokens
+			l.last = time.Now().Add(-tt.since)
+			l.mu.Unlock()
+
+			l.refund()
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.tokens > l.burst {
+				t.Errorf("tokens = %.2f, want at most the burst of %.0f", l.tokens, l.burst)
+			}
+		})
+	}
+}
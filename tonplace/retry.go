@@ -0,0 +1,162 @@
+package tonplace
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ====================================================================================
+// RETRIES
+// ====================================================================================
+// Transient failures (network errors, HTTP 5xx, HTTP 429) are retried with
+// exponential backoff and jitter. When the API sends a Retry-After header,
+// the client waits at least that long before the next attempt - unless the
+// header asks for more than MaxRetryAfter, then the error is returned at once.
+//
+// Only requests that are safe to repeat are retried on every transient failure:
+//   - GET requests are retried on network errors, 5xx and 429
+//   - POST /apps/purchase/create is NOT idempotent: a retry after a 5xx or a timeout
+//     could create a second purchase. It is only retried when the API certainly did
+//     not process it - a 429 response, or a connection that could not be established.
+// ====================================================================================
+
+// RetryPolicy configures how failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts - Total number of attempts including the first one
+	// 1 (or less) disables retries
+	MaxAttempts int
+
+	// InitialBackoff - Delay before the first retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff - Upper bound for the computed backoff delay
+	// Does not limit delays requested by a Retry-After header
+	MaxBackoff time.Duration
+
+	// Multiplier - Growth factor of the delay after each attempt (e.g. 2 doubles it)
+	Multiplier float64
+
+	// MaxRetryAfter - Longest Retry-After delay the client is willing to wait
+	// A longer hint ends the retries and returns the error (0 = no limit)
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy is used by NewClient unless WithRetryPolicy is given.
+// It makes up to 3 attempts with delays of roughly 200ms and 400ms,
+// and waits at most 10 seconds for a Retry-After hint.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	MaxRetryAfter:  10 * time.Second,
+}
+
+// NoRetry disables retries; every request is attempted exactly once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// WithRetryPolicy sets the retry policy of the client.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// backoff returns the delay before retry number n (1 = first retry).
+// The delay grows exponentially and is randomized between 50% and 100%
+// of its value so that many clients don't retry in lockstep.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		delay *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// isRetryable reports whether a failed request may be sent again.
+func isRetryable(method string, err error) bool {
+	// The caller cancelled or ran out of time - never retry
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// Rate limited requests were rejected before processing, so they are always safe to repeat
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	// The connection was never established, so the request never reached the API
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	// Everything else may have been processed by the API.
+	// Only repeat requests without side effects.
+	if method != http.MethodGet {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return errors.Is(err, ErrUpstreamUnavailable)
+}
+
+// retryAfter extracts the delay requested by the API in a Retry-After header.
+// Returns 0 if the error carries no such hint.
+func retryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header value, given either as
+// a number of seconds or as an HTTP date. Returns 0 if absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package tonplace_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := tonplace.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	tests := []struct {
+		name         string
+		post         bool
+		failure      tonplacetest.Failure
+		wantErr      error
+		wantRequests int
+	}{
+		{"GET retried on 5xx", false, tonplacetest.Failure{StatusCode: 503, Times: 2}, nil, 3},
+		{"GET gives up after MaxAttempts", false, tonplacetest.Failure{StatusCode: 500, Times: 5}, tonplace.ErrUpstreamUnavailable, 3},
+		{"GET not retried on 4xx", false, tonplacetest.Failure{StatusCode: 400}, tonplace.ErrInvalidRequest, 1},
+		{"POST not retried on 5xx", true, tonplacetest.Failure{StatusCode: 500}, tonplace.ErrUpstreamUnavailable, 1},
+		{"POST retried on 429", true, tonplacetest.Failure{StatusCode: 429, RetryAfter: "0"}, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tonplacetest.NewServer("1", "secret")
+			defer srv.Close()
+			client := srv.APIClient(tonplace.WithRetryPolicy(policy))
+			srv.Fail(tt.failure)
+
+			var err error
+			if tt.post {
+				_, err = client.CreatePurchase(context.Background(), 7, 100, "Coins")
+			} else {
+				_, err = client.ListPurchases(context.Background(), tonplace.ListPurchasesOptions{})
+			}
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if n := srv.Requests(); n != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", n, tt.wantRequests)
+			}
+			if tt.post && tt.wantErr != nil && len(srv.Purchases()) > 0 {
+				t.Error("failed POST created a purchase")
+			}
+		})
+	}
+}
+
+func TestRetryAfterAboveLimitGivesUp(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+	client := srv.APIClient(tonplace.WithRetryPolicy(tonplace.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Multiplier:     2,
+		MaxRetryAfter:  time.Second,
+	}))
+	srv.Fail(tonplacetest.Failure{StatusCode: 429, RetryAfter: "120"})
+
+	// No deadline: only MaxRetryAfter keeps the call from sleeping for two minutes
+	start := time.Now()
+	_, err := client.ListPurchases(context.Background(), tonplace.ListPurchasesOptions{})
+	if !errors.Is(err, tonplace.ErrRateLimited) {
+		t.Fatalf("error = %v, want %v", err, tonplace.ErrRateLimited)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %s, want no wait", elapsed)
+	}
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,361 @@
+// ====================================================================================
+// FAKE TON.PLACE API
+// ====================================================================================
+// Package tonplacetest provides an in-memory fake of the Ton.Place Public API
+// for tests. It runs on httptest and implements:
+//   - GET  /apps/purchases        - with count, last_id, status and userId filters
+//   - POST /apps/purchase/create  - with the documented validation rules
+//
+// Usage:
+//
+//	srv := tonplacetest.NewServer("1", "secret")
+//	defer srv.Close()
+//
+//	client := srv.APIClient()
+//	purchaseID, _ := client.CreatePurchase(ctx, 42, 100, "Premium")
+//	srv.MarkPaid(purchaseID)
+//
+//	srv.Fail(tonplacetest.Failure{StatusCode: http.StatusServiceUnavailable, Times: 2})
+// ====================================================================================
+
+package tonplacetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tonplace_app_demo/tonplace"
+)
+
+// defaultCount - Page size used by the API when "count" is not given
+const defaultCount = 20
+
+// maxTitleLen - Maximum purchase title length accepted by the API
+const maxTitleLen = 150
+
+// Failure describes an error the fake server injects instead of a normal response.
+type Failure struct {
+	// StatusCode - HTTP status to respond with (e.g. 500, 503, 429)
+	// Ignored when Malformed is set
+	StatusCode int
+
+	// RetryAfter - Value of the Retry-After header (empty = not sent)
+	RetryAfter string
+
+	// Malformed - Respond with HTTP 200 and a truncated, unparseable JSON body
+	Malformed bool
+
+	// Times - Number of requests the failure applies to (0 = 1)
+	Times int
+}
+
+// Server is a fake Ton.Place API. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// AppID - Expected App-Id header
+	AppID string
+
+	// Secret - Expected Secret header
+	Secret string
+
+	mu        sync.Mutex
+	purchases map[int64]*tonplace.Transaction
+	nextID    int64
+	failures  []Failure
+	latency   time.Duration
+	requests  int
+}
+
+// NewServer starts a fake API accepting the given app credentials.
+// Call Close when done.
+func NewServer(appID, secret string) *Server {
+	s := &Server{
+		AppID:     appID,
+		Secret:    secret,
+		purchases: make(map[int64]*tonplace.Transaction),
+		nextID:    1,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps/purchases", s.handleList)
+	mux.HandleFunc("/apps/purchase/create", s.handleCreate)
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// APIClient returns a tonplace.Client pointed at this server with its credentials.
+// Retries are disabled unless opts configure them, so injected failures surface directly.
+func (s *Server) APIClient(opts ...tonplace.Option) *tonplace.Client {
+	base := []tonplace.Option{
+		tonplace.WithBaseURL(s.URL),
+		tonplace.WithHTTPClient(s.Client()),
+		tonplace.WithRetryPolicy(tonplace.NoRetry),
+	}
+	return tonplace.NewClient(s.AppID, s.Secret, append(base, opts...)...)
+}
+
+// ====================================================================================
+// TEST CONTROLS
+// ====================================================================================
+
+// AddPurchase stores a purchase as if it was created earlier and returns its ID.
+// A zero ID is assigned automatically; empty Status and Currency default to
+// "pending" and "eur", a zero CreatedAt to the current time.
+func (s *Server) AddPurchase(tx tonplace.Transaction) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tx.ID == 0 {
+		tx.ID = s.nextID
+	}
+	if tx.ID >= s.nextID {
+		s.nextID = tx.ID + 1
+	}
+	if tx.Status == "" {
+		tx.Status = tonplace.StatusPending
+	}
+	if tx.Currency == "" {
+		tx.Currency = "eur"
+	}
+	if tx.CreatedAt == 0 {
+		tx.CreatedAt = time.Now().Unix()
+	}
+	s.purchases[tx.ID] = &tx
+	return tx.ID
+}
+
+// MarkPaid changes the status of a purchase to "paid", as if the user completed payment.
+func (s *Server) MarkPaid(purchaseID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.purchases[purchaseID]
+	if !ok {
+		return fmt.Errorf("tonplacetest: purchase %d not found", purchaseID)
+	}
+	tx.Status = tonplace.StatusPaid
+	return nil
+}
+
+// Purchase returns a copy of a stored purchase.
+func (s *Server) Purchase(purchaseID int64) (tonplace.Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.purchases[purchaseID]
+	if !ok {
+		return tonplace.Transaction{}, false
+	}
+	return *tx, true
+}
+
+// Purchases returns copies of all stored purchases, newest first.
+func (s *Server) Purchases() []tonplace.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocked()
+}
+
+// Fail queues a failure. Queued failures are consumed in order, one per request,
+// before normal handling resumes.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+	s.failures = append(s.failures, f)
+}
+
+// SetLatency delays every response by d (0 = respond immediately).
+// The delay is cut short when the client gives up on the request.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Requests returns the number of requests received so far, including rejected ones.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ====================================================================================
+// HANDLERS
+// ====================================================================================
+
+// middleware counts requests, applies latency and injected failures, and checks credentials.
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		latency := s.latency
+		var failure *Failure
+		if len(s.failures) > 0 {
+			f := s.failures[0]
+			failure = &f
+			if s.failures[0].Times--; s.failures[0].Times <= 0 {
+				s.failures = s.failures[1:]
+			}
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if failure != nil {
+			if failure.RetryAfter != "" {
+				w.Header().Set("Retry-After", failure.RetryAfter)
+			}
+			if failure.Malformed {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"transactions": [{"id": 1, "amou`))
+				return
+			}
+			writeError(w, failure.StatusCode, "injected_failure", http.StatusText(failure.StatusCode))
+			return
+		}
+
+		if r.Header.Get("App-Id") != s.AppID || r.Header.Get("Secret") != s.Secret {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "invalid App-Id or Secret")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleList implements GET /apps/purchases.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use GET")
+		return
+	}
+	q := r.URL.Query()
+
+	count := defaultCount
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > tonplace.MaxPageSize {
+			writeError(w, http.StatusBadRequest, "invalid_count", "count must be between 1 and 100")
+			return
+		}
+		count = n
+	}
+	var lastID int64
+	if v := q.Get("last_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_last_id", "last_id must be a non-negative integer")
+			return
+		}
+		lastID = n
+	}
+	status := q.Get("status")
+	if status != "" && status != tonplace.StatusPending && status != tonplace.StatusPaid {
+		writeError(w, http.StatusBadRequest, "invalid_status", `status must be "pending" or "paid"`)
+		return
+	}
+	var userID int64
+	if v := q.Get("userId"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid_user_id", "userId must be a non-negative integer")
+			return
+		}
+		userID = n
+	}
+
+	s.mu.Lock()
+	all := s.sortedLocked()
+	s.mu.Unlock()
+
+	// Newest first; last_id continues with older transactions
+	result := []tonplace.Transaction{}
+	for _, tx := range all {
+		if lastID > 0 && tx.ID >= lastID {
+			continue
+		}
+		if status != "" && tx.Status != status {
+			continue
+		}
+		if userID > 0 && tx.UserID != userID {
+			continue
+		}
+		result = append(result, tx)
+		if len(result) == count {
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, tonplace.TransactionsResponse{Transactions: result})
+}
+
+// handleCreate implements POST /apps/purchase/create.
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use POST")
+		return
+	}
+	var req tonplace.CreatePurchaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "request body must be JSON")
+		return
+	}
+	switch {
+	case req.Amount <= 0:
+		writeError(w, http.StatusBadRequest, "invalid_amount", "amount must be greater than 0")
+		return
+	case req.Currency != "eur":
+		writeError(w, http.StatusBadRequest, "invalid_currency", `currency must be "eur"`)
+		return
+	case req.Title == "" || len(req.Title) > maxTitleLen:
+		writeError(w, http.StatusBadRequest, "invalid_title", "title is required and must be 150 characters or less")
+		return
+	case req.UserID <= 0:
+		writeError(w, http.StatusBadRequest, "invalid_user_id", "user_id is required")
+		return
+	}
+
+	id := s.AddPurchase(tonplace.Transaction{
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Title:    req.Title,
+		UserID:   req.UserID,
+		Status:   tonplace.StatusPending,
+	})
+	writeJSON(w, http.StatusOK, tonplace.CreatePurchaseResponse{PurchaseID: id})
+}
+
+// sortedLocked returns copies of all purchases ordered by ID, newest first.
+// Caller must hold s.mu.
+func (s *Server) sortedLocked() []tonplace.Transaction {
+	all := make([]tonplace.Transaction, 0, len(s.purchases))
+	for _, tx := range s.purchases {
+		all = append(all, *tx)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID > all[j].ID })
+	return all
+}
+
+// writeJSON writes v as JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an API error response: {"error": {"code": ..., "message": ...}}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
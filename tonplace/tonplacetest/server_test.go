@@ -0,0 +1,167 @@
+package tonplacetest_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tonplace_app_demo/tonplace"
+	"tonplace_app_demo/tonplace/tonplacetest"
+)
+
+// call sends a raw request to the fake, bypassing the client's own validation.
+// Returns the status, the Retry-After header and the body.
+func call(t *testing.T, srv *tonplacetest.Server, method, path, body string, headers map[string]string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("App-Id", srv.AppID)
+	req.Header.Set("Secret", srv.Secret)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("Retry-After"), string(data)
+}
+
+// errorCode returns the code of an API error body.
+func errorCode(body string) string {
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal([]byte(body), &resp)
+	return resp.Error.Code
+}
+
+func TestServerRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		headers  map[string]string
+		wantCode int
+		wantErr  string // Expected error code (empty = success)
+		wantTxs  int    // Expected number of transactions for successful lists
+	}{
+		{"credentials accepted", "GET", "/apps/purchases", "", nil, 200, "", 3},
+		{"wrong secret", "GET", "/apps/purchases", "", map[string]string{"Secret": "guess"}, 401, "unauthorized", 0},
+		{"wrong app id", "GET", "/apps/purchases", "", map[string]string{"App-Id": "2"}, 401, "unauthorized", 0},
+		{"count", "GET", "/apps/purchases?count=2", "", nil, 200, "", 2},
+		{"count 0", "GET", "/apps/purchases?count=0", "", nil, 400, "invalid_count", 0},
+		{"count above maximum", "GET", "/apps/purchases?count=101", "", nil, 400, "invalid_count", 0},
+		{"count not a number", "GET", "/apps/purchases?count=all", "", nil, 400, "invalid_count", 0},
+		{"last_id", "GET", "/apps/purchases?last_id=3", "", nil, 200, "", 2},
+		{"status", "GET", "/apps/purchases?status=paid", "", nil, 200, "", 1},
+		{"unknown status", "GET", "/apps/purchases?status=refunded", "", nil, 400, "invalid_status", 0},
+		{"userId", "GET", "/apps/purchases?userId=8", "", nil, 200, "", 1},
+		{"list with POST", "POST", "/apps/purchases", "", nil, 405, "method_not_allowed", 0},
+		{"create", "POST", "/apps/purchase/create", `{"user_id": 7, "amount": 100, "currency": "eur", "title": "Coins"}`, nil, 200, "", 0},
+		{"create without amount", "POST", "/apps/purchase/create", `{"user_id": 7, "currency": "eur", "title": "Coins"}`, nil, 400, "invalid_amount", 0},
+		{"create in another currency", "POST", "/apps/purchase/create", `{"user_id": 7, "amount": 100, "currency": "usd", "title": "Coins"}`, nil, 400, "invalid_currency", 0},
+		{"create with a long title", "POST", "/apps/purchase/create", `{"user_id": 7, "amount": 100, "currency": "eur", "title": "` + strings.Repeat("x", 151) + `"}`, nil, 400, "invalid_title", 0},
+		{"create without user", "POST", "/apps/purchase/create", `{"amount": 100, "currency": "eur", "title": "Coins"}`, nil, 400, "invalid_user_id", 0},
+		{"create with invalid JSON", "POST", "/apps/purchase/create", `{`, nil, 400, "invalid_body", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tonplacetest.NewServer("1", "secret")
+			defer srv.Close()
+			srv.AddPurchase(tonplace.Transaction{UserID: 7, Amount: 100})
+			paid := srv.AddPurchase(tonplace.Transaction{UserID: 7, Amount: 200})
+			srv.MarkPaid(paid)
+			srv.AddPurchase(tonplace.Transaction{UserID: 8, Amount: 300})
+
+			code, _, body := call(t, srv, tt.method, tt.path, tt.body, tt.headers)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", code, tt.wantCode, body)
+			}
+			if got := errorCode(body); got != tt.wantErr {
+				t.Errorf("error code = %q, want %q", got, tt.wantErr)
+			}
+			if tt.wantErr != "" || tt.method != "GET" {
+				return
+			}
+			var resp tonplace.TransactionsResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Transactions) != tt.wantTxs {
+				t.Errorf("got %d transactions, want %d", len(resp.Transactions), tt.wantTxs)
+			}
+		})
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+
+	// Queued failures apply in order, each to Times requests, before credentials are checked
+	srv.Fail(tonplacetest.Failure{StatusCode: 503, Times: 2})
+	srv.Fail(tonplacetest.Failure{StatusCode: 429, RetryAfter: "7"})
+	srv.Fail(tonplacetest.Failure{Malformed: true})
+
+	want := []struct {
+		code       int
+		retryAfter string
+	}{
+		{503, ""},
+		{503, ""},
+		{429, "7"},
+		{200, ""}, // Malformed
+		{200, ""}, // Normal handling resumes
+	}
+	for i, w := range want {
+		code, retryAfter, body := call(t, srv, "GET", "/apps/purchases", "", nil)
+		if code != w.code || retryAfter != w.retryAfter {
+			t.Errorf("request %d: status %d, Retry-After %q; want %d, %q", i+1, code, retryAfter, w.code, w.retryAfter)
+		}
+		var resp tonplace.TransactionsResponse
+		err := json.Unmarshal([]byte(body), &resp)
+		if malformed := i == 3; malformed != (err != nil) {
+			t.Errorf("request %d: body %q, parse error %v", i+1, body, err)
+		}
+	}
+	if n := srv.Requests(); n != len(want) {
+		t.Errorf("Requests() = %d, want %d", n, len(want))
+	}
+}
+
+func TestServerCreatedPurchasesAreListed(t *testing.T) {
+	srv := tonplacetest.NewServer("1", "secret")
+	defer srv.Close()
+	code, _, body := call(t, srv, "POST", "/apps/purchase/create", `{"user_id": 7, "amount": 100, "currency": "eur", "title": "Coins"}`, nil)
+	if code != 200 {
+		t.Fatalf("create: status %d, body %s", code, body)
+	}
+	var created tonplace.CreatePurchaseResponse
+	json.Unmarshal([]byte(body), &created)
+
+	tx, ok := srv.Purchase(created.PurchaseID)
+	if !ok || tx.UserID != 7 || tx.Amount != 100 || tx.Status != tonplace.StatusPending {
+		t.Errorf("stored purchase = %+v, %v", tx, ok)
+	}
+	if err := srv.MarkPaid(created.PurchaseID); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.MarkPaid(999); err == nil {
+		t.Error("MarkPaid of an unknown purchase succeeded")
+	}
+	_, _, body = call(t, srv, "GET", "/apps/purchases?status=paid", "", nil)
+	if !strings.Contains(body, `"status":"paid"`) {
+		t.Errorf("paid purchase not listed: %s", body)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+// ====================================================================================
+// LAUNCH VERIFIER
+// ====================================================================================
+// Verifier bundles all checks of a launch into one configurable type:
+//   1. Required parameters are present
+//   2. The timestamp is neither too old nor too far in the future
+//   3. The signature matches one of the active secrets
+//
+// Every failure is reported as a distinct error that works with errors.Is:
+//
+//	user, err := verifier.Verify(r.URL.Query())
+//	switch {
+//	case errors.Is(err, ErrLaunchExpired):      // ask the user to reopen the app
+//	case errors.Is(err, ErrLaunchBadSignature): // log a possible attack
+//	}
+//
+// The clock is injectable, so expiry can be tested without waiting.
+// ====================================================================================
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrLaunchMissingParam - A required launch parameter is absent or empty
+	ErrLaunchMissingParam = errors.New("missing launch parameter")
+
+	// ErrLaunchInvalidTimestamp - The ts parameter is not a unix timestamp
+	ErrLaunchInvalidTimestamp = errors.New("invalid launch timestamp")
+
+	// ErrLaunchExpired - The launch is older than MaxAge
+	ErrLaunchExpired = errors.New("launch expired")
+
+	// ErrLaunchFuture - The launch timestamp is further in the future than FutureSkew allows
+	ErrLaunchFuture = errors.New("launch timestamp in the future")
+
+	// ErrLaunchBadSignature - The hash does not match any active secret
+	ErrLaunchBadSignature = errors.New("invalid launch signature")
+)
+
+// DefaultRequiredParams - Launch parameters Ton.Place always sends with a value
+var DefaultRequiredParams = []string{"app_id", "user_id", "ts", "hash"}
+
+// Clock tells the current time. Replace it in tests to control expiry.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock backed by time.Now.
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock - Clock returning the real current time
+var SystemClock Clock = systemClock{}
+
+// Verifier checks launch parameters of one app.
+type Verifier struct {
+	// Secrets - Secrets accepted for the signature, current secret first
+	Secrets []AppSecret
+
+	// MaxAge - Maximum age of the launch timestamp
+	MaxAge time.Duration
+
+	// FutureSkew - How far the launch timestamp may be ahead of our clock
+	FutureSkew time.Duration
+
+	// RequiredParams - Parameters that must be present and non-empty
+	RequiredParams []string
+
+	// Clock - Source of the current time (nil = SystemClock)
+	Clock Clock
+}
+
+// NewVerifier creates a verifier with the default policy:
+// SIGNATURE_MAX_AGE, 60 seconds of future skew and DefaultRequiredParams.
+func NewVerifier(secrets []AppSecret) *Verifier {
+	return &Verifier{
+		Secrets:        secrets,
+		MaxAge:         SIGNATURE_MAX_AGE * time.Second,
+		FutureSkew:     60 * time.Second,
+		RequiredParams: DefaultRequiredParams,
+		Clock:          SystemClock,
+	}
+}
+
+// Verify checks the launch parameters and returns the verified user.
+func (v *Verifier) Verify(values url.Values) (UserParams, error) {
+	params, _, err := v.VerifyWithSecretID(values)
+	return params, err
+}
+
+// VerifyWithSecretID is like Verify, but also returns the ID of the secret
+// that matched, so callers can detect traffic still signed with an old secret.
+func (v *Verifier) VerifyWithSecretID(values url.Values) (UserParams, string, error) {
+	params := UserParams{
+		AppID:     values.Get("app_id"),
+		UserID:    values.Get("user_id"),
+		Timestamp: values.Get("ts"),
+		FirstName: values.Get("first_name"), // May be empty if not sent
+		LastName:  values.Get("last_name"),  // May be empty if not sent
+		Hash:      values.Get("hash"),
+	}
+
+	// Step 1: Required parameters
+	for _, name := range v.RequiredParams {
+		if values.Get(name) == "" {
+			return params, "", fmt.Errorf("%w: %s", ErrLaunchMissingParam, name)
+		}
+	}
+
+	// Step 2: Timestamp window
+	if err := v.CheckTimestamp(params.Timestamp); err != nil {
+		return params, "", err
+	}
+
+	// Step 3: Signature over ALL parameters, tried against every active secret
+	secretID, ok := VerifySignatureWithSecrets(values, v.Secrets, v.now())
+	if !ok {
+		return params, "", ErrLaunchBadSignature
+	}
+	return params, secretID, nil
+}
+
+// CheckTimestamp checks that a launch timestamp lies within the allowed window.
+// This prevents replay attacks where an attacker captures a valid request and resends it later.
+func (v *Verifier) CheckTimestamp(tsStr string) error {
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return ErrLaunchInvalidTimestamp
+	}
+	age := v.now().Sub(time.Unix(ts, 0))
+
+	// Reject if timestamp is in the future (clock skew tolerance)
+	if age < -v.FutureSkew {
+		return fmt.Errorf("%w: %s ahead", ErrLaunchFuture, (-age).Round(time.Second))
+	}
+
+	// Reject if timestamp is too old
+	if age > v.MaxAge {
+		return fmt.Errorf("%w: %s old", ErrLaunchExpired, age.Round(time.Second))
+	}
+	return nil
+}
+
+// now returns the current time of the verifier's clock.
+func (v *Verifier) now() time.Time {
+	if v.Clock == nil {
+		return SystemClock.Now()
+	}
+	return v.Clock.Now()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock stopped at a fixed time.
+type fakeClock struct{ t time.Time }
+
+func (c fakeClock) Now() time.Time { return c.t }
+
+// signedLaunch builds launch parameters signed with secret, launched at ts.
+func signedLaunch(secret string, ts time.Time) url.Values {
+	q := url.Values{
+		"app_id":     {"1"},
+		"user_id":    {"42"},
+		"ts":         {strconv.FormatInt(ts.Unix(), 10)},
+		"first_name": {"Ada"},
+	}
+	q.Set("hash", SignParams(launchParams(q), secret))
+	return q
+}
+
+func TestVerifierVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rotated := now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		values     func() url.Values
+		secrets    []AppSecret
+		wantErr    error
+		wantSecret string
+	}{
+		{
+			name:       "valid",
+			values:     func() url.Values { return signedLaunch("current", now.Add(-time.Minute)) },
+			wantSecret: "new",
+		},
+		{
+			name:       "signed with the previous secret",
+			values:     func() url.Values { return signedLaunch("previous", now) },
+			wantSecret: "old",
+		},
+		{
+			name:   "previous secret after its deadline",
+			values: func() url.Values { return signedLaunch("previous", now) },
+			secrets: []AppSecret{
+				{ID: "new", Secret: "current"},
+				{ID: "old", Secret: "previous", ValidUntil: rotated},
+			},
+			wantErr: ErrLaunchBadSignature,
+		},
+		{
+			name:    "expired",
+			values:  func() url.Values { return signedLaunch("current", now.Add(-SIGNATURE_MAX_AGE*time.Second-time.Second)) },
+			wantErr: ErrLaunchExpired,
+		},
+		{
+			name:       "at the maximum age",
+			values:     func() url.Values { return signedLaunch("current", now.Add(-SIGNATURE_MAX_AGE*time.Second)) },
+			wantSecret: "new",
+		},
+		{
+			name:    "from the future",
+			values:  func() url.Values { return signedLaunch("current", now.Add(2*time.Minute)) },
+			wantErr: ErrLaunchFuture,
+		},
+		{
+			name:       "within the future skew",
+			values:     func() url.Values { return signedLaunch("current", now.Add(30*time.Second)) },
+			wantSecret: "new",
+		},
+		{
+			name: "missing user_id",
+			values: func() url.Values {
+				q := signedLaunch("current", now)
+				q.Del("user_id")
+				return q
+			},
+			wantErr: ErrLaunchMissingParam,
+		},
+		{
+			name: "missing hash",
+			values: func() url.Values {
+				q := signedLaunch("current", now)
+				q.Del("hash")
+				return q
+			},
+			wantErr: ErrLaunchMissingParam,
+		},
+		{
+			name: "invalid timestamp",
+			values: func() url.Values {
+				q := signedLaunch("current", now)
+				q.Set("ts", "soon")
+				return q
+			},
+			wantErr: ErrLaunchInvalidTimestamp,
+		},
+		{
+			name:    "unknown secret",
+			values:  func() url.Values { return signedLaunch("attacker", now) },
+			wantErr: ErrLaunchBadSignature,
+		},
+		{
+			name: "tampered parameter",
+			values: func() url.Values {
+				q := signedLaunch("current", now)
+				q.Set("user_id", "43")
+				return q
+			},
+			wantErr: ErrLaunchBadSignature,
+		},
+		{
+			name: "added parameter",
+			values: func() url.Values {
+				q := signedLaunch("current", now)
+				q.Set("last_name", "Lovelace")
+				return q
+			},
+			wantErr: ErrLaunchBadSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := tt.secrets
+			if secrets == nil {
+				secrets = []AppSecret{{ID: "new", Secret: "current"}, {ID: "old", Secret: "previous"}}
+			}
+			v := NewVerifier(secrets)
+			v.Clock = fakeClock{now}
+
+			user, secretID, err := v.VerifyWithSecretID(tt.values())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if secretID != tt.wantSecret {
+				t.Errorf("secret = %q, want %q", secretID, tt.wantSecret)
+			}
+			if user.UserID != "42" || user.FirstName != "Ada" {
+				t.Errorf("user = %+v", user)
+			}
+		})
+	}
+}